@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -16,7 +18,7 @@ func (app application) createCompanyHandler(w http.ResponseWriter, r *http.Reque
 	var input struct {
 		Name         string  `json:"name"`
 		Address      string  `json:"address"`
-		SalesOwner   string  `json:"sales_owner"`
+		SalesOwner   string  `json:"sales_owner" validate:"required,uuid"`
 		Email        string  `json:"email"`
 		CompanySize  string  `json:"company_size"`
 		Industry     string  `json:"industry"`
@@ -24,11 +26,14 @@ func (app application) createCompanyHandler(w http.ResponseWriter, r *http.Reque
 		Country      string  `json:"country"`
 		Image        *string `json:"image"`
 		Website      *string `json:"website"`
+		ParentID     *string `json:"parent_id"`
+		// CustomFields maps custom field keys to values.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -47,35 +52,57 @@ func (app application) createCompanyHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Validate the input values including the sales owner id format
-	v.ValidateUUID(input.SalesOwner, "sale_owner")
+	v.Struct(input)
+	if input.ParentID != nil {
+		v.ValidateUUID(*input.ParentID, "parent_id")
+	}
+
+	company.CustomFields = data.CustomFields{}
+	company.CustomFields.Apply(input.CustomFields)
+
+	err = app.validateCustomFields(r.Context(), "companies", company.CustomFields, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if data.ValidateCompany(v, company); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	company.SalesOwner = uuid.MustParse(input.SalesOwner)
+	if input.ParentID != nil {
+		parentID := uuid.MustParse(*input.ParentID)
+		company.ParentID = &parentID
+	}
 
-	err = app.models.Companies.Insert(company)
+	err = app.models.Companies.Insert(r.Context(), company)
 	if err != nil {
 
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "email already in use")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInvalidUUID):
+			v.AddError("parent_id", "company does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			//TODO check for existing sales_owner
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
 	}
 
+	app.metrics.companiesCreated.Inc()
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/companies/%s", company.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/companies/%s", company.ID))
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"company": company}, headers)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
@@ -88,40 +115,122 @@ func (app application) getCompanyByIDHandler(w http.ResponseWriter, r *http.Requ
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	company, err := app.models.Companies.GetByIDWithSalesOwner(uuid.MustParse(IDParam))
+	company, err := app.models.Companies.GetByIDWithSalesOwner(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
-		fmt.Println(err)
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "company not found")
+			app.notFoundResponse(w, r, "company")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": company}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCompanyTreeHandler returns the hierarchy of subsidiaries below a
+// company, with contact counts and quote values rolled up at each level,
+// and the companies above it.
+func (app application) getCompanyTreeHandler(w http.ResponseWriter, r *http.Request) {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tree, err := app.models.Companies.GetTree(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "company")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": tree}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app application) listCompaniesHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		data.Filters
+	qs, ok := app.listQuery(w, r, "companies")
+	if !ok {
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAll(r.Context(), "companies")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	qs := r.URL.Query()
+	filters := app.companyListFilters(r, qs, fields, v)
+	columns := readColumns(qs, companyExportColumns, v)
+	download := readExport(r, qs, columns, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if download != nil {
+		exportRows(app, w, r, "companies", download, func(ctx context.Context, fn func(*data.CompanyWithSalesOwner) error) error {
+			return app.models.Companies.Export(ctx, filters, fn)
+		})
+		return
+	}
 
-	input.Page = app.readInt(qs, "page", 1, v)
-	input.PageSize = app.readInt(qs, "page_size", 10, v)
-	input.Sort = app.readString(qs, "sort", "-created_at")
-	input.SortSafeList =
+	companies, metadata, err := app.models.Companies.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := pickColumns(companies, qs, columns)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": records, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+// companyListFilters reads the list parameters of GET /companies, including
+// filters and sorts on the entity's custom fields.
+func (app application) companyListFilters(r *http.Request, qs url.Values, fields []*data.CustomField, v *validator.Validator) data.Filters {
+	var filters data.Filters
+
+	app.readPage(qs, &filters, v)
+	filters.Search = app.readString(qs, "q", "")
+
+	defaultSort := "-created_at"
+	if filters.Search != "" {
+		defaultSort = "-relevance"
+	}
+	filters.Sort = app.readString(qs, "sort", defaultSort)
+	filters.SortSafeList =
 		[]string{
 			"id",
 			"name",
@@ -136,22 +245,15 @@ func (app application) listCompaniesHandler(w http.ResponseWriter, r *http.Reque
 			"-updated_at",
 		}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
-		return
+	if filters.Search != "" {
+		filters.SortSafeList = append(filters.SortSafeList, "-relevance")
 	}
 
-	companies, metadata, err := app.models.Companies.GetAll(input.Filters)
-	if err != nil {
-		app.serverErrorResponse(w, err)
-		return
-	}
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"data": companies, "metadata": metadata}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, err)
-	}
+	filters.FilterSafeList = data.CompanyFilterFields
+	filters.AddCustomFields("c", fields)
+	app.readConditions(r, qs, &filters, v)
 
+	return filters
 }
 
 func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,7 +262,7 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 	var input struct {
 		Name         *string `json:"name"`
 		Address      *string `json:"address"`
-		SalesOwner   *string `json:"sales_owner"`
+		SalesOwner   *string `json:"sales_owner" validate:"uuid"`
 		Email        *string `json:"email"`
 		CompanySize  *string `json:"company_size"`
 		Industry     *string `json:"industry"`
@@ -168,16 +270,20 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 		Country      *string `json:"country"`
 		Image        *string `json:"image"`
 		Website      *string `json:"website"`
+		// ParentID "" detaches the company from its parent.
+		ParentID *string `json:"parent_id"`
+		// CustomFields sets the custom fields given; null clears one.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	if app.isAllNil(input) {
-		app.badRequestResponse(w, errors.New("body must not be empty"))
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
 		return
 	}
 
@@ -186,17 +292,19 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 	// Validate UUIDs
 	v.Check(IDParam != "", "id", "id is required")
 	v.ValidateUUID(IDParam, "id")
-	if input.SalesOwner != nil {
-		v.ValidateUUID(*input.SalesOwner, "sales_owner")
+	v.Struct(input)
+	if input.ParentID != nil && *input.ParentID != "" {
+		v.ValidateUUID(*input.ParentID, "parent_id")
+		v.Check(*input.ParentID != IDParam, "parent_id", "must not be the company itself")
 	}
 
-	company, err := app.models.Companies.GetByID(uuid.MustParse(IDParam))
+	company, err := app.models.Companies.GetByID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "company not found")
+			app.notFoundResponse(w, r, "company")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -240,20 +348,38 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 		company.Website = input.Website
 	}
 
+	if input.CustomFields != nil {
+		company.CustomFields.Apply(input.CustomFields)
+
+		err = app.validateCustomFields(r.Context(), "companies", company.CustomFields, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	if data.ValidateCompany(v, company); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	if input.ParentID != nil {
+		company.ParentID = nil
+		if *input.ParentID != "" {
+			parentID := uuid.MustParse(*input.ParentID)
+			company.ParentID = &parentID
+		}
+	}
+
 	if input.SalesOwner != nil {
 		salesOwnerID := uuid.MustParse(*input.SalesOwner)
-		_, err := app.models.Users.GetByID(salesOwnerID)
+		_, err := app.models.Users.GetByID(r.Context(), salesOwnerID)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
-				app.notFoundResponse(w, "sales_owner not found")
+				app.notFoundResponse(w, r, "sales_owner")
 			default:
-				app.serverErrorResponse(w, err)
+				app.serverErrorResponse(w, r, err)
 			}
 
 			return
@@ -262,14 +388,20 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 		company.SalesOwner = salesOwnerID
 	}
 
-	err = app.models.Companies.Update(company)
+	err = app.models.Companies.Update(r.Context(), company)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "email already in use")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInvalidUUID):
+			v.AddError("parent_id", "company does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCompanyCycle):
+			v.AddError("parent_id", "must not be the company itself or one of its subsidiaries")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
@@ -277,36 +409,78 @@ func (app application) updatedCompanyHandler(w http.ResponseWriter, r *http.Requ
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": company}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// deleteCompanyHandler moves a company to the trash. ?dependents= says
+// what happens to its contacts, quotes and projects: block (the default)
+// refuses while there are any, cascade trashes them too and reassign moves
+// them to the company in ?reassign_to=. With ?dry_run=true nothing changes
+// and the response shows what would.
 func (app application) deleteCompanyHandler(w http.ResponseWriter, r *http.Request) {
 	IDParam := chi.URLParam(r, "id")
+	qs := r.URL.Query()
 
 	v := validator.New()
 
+	action := app.readString(qs, "dependents", data.DependentsBlock)
+	reassignParam := app.readString(qs, "reassign_to", "")
+	dryRun := app.readBool(qs, "dry_run", false, v)
+
 	v.Check(IDParam != "", "id", "id is required")
 	v.ValidateUUID(IDParam, "id")
+	v.Check(validator.PermittedValues(action, data.DependentsBlock, data.DependentsCascade, data.DependentsReassign), "dependents", "must be block, cascade or reassign")
+
+	var reassignTo *uuid.UUID
+	if action == data.DependentsReassign {
+		v.Check(reassignParam != "", "reassign_to", "must be provided to reassign dependents")
+		if reassignParam != "" {
+			v.ValidateUUID(reassignParam, "reassign_to")
+			v.Check(reassignParam != IDParam, "reassign_to", "must not be the company being deleted")
+		}
+	} else {
+		v.Check(reassignParam == "", "reassign_to", "is only allowed with dependents=reassign")
+	}
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err := app.models.Companies.Delete(uuid.MustParse(IDParam))
+	if action == data.DependentsReassign {
+		ID := uuid.MustParse(reassignParam)
+		reassignTo = &ID
+	}
+
+	deletion, err := app.models.Companies.Delete(r.Context(), uuid.MustParse(IDParam), action, reassignTo, dryRun, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "company not found")
+			app.notFoundResponse(w, r, "company")
+		case errors.Is(err, data.ErrHasDependents):
+			app.hasDependentsResponse(w, r, deletion.Dependents)
+		case errors.Is(err, data.ErrInvalidUUID):
+			v.AddError("reassign_to", "company does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "company deleted successfully"}, nil)
+	if dryRun {
+		err = app.writeJSON(w, http.StatusOK, envelope{"data": deletion}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.metrics.companiesDeleted.Inc()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "company deleted successfully", "data": deletion}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kharljhon14/zentrix/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is prepended to every flag name to form its environment
+// variable, e.g. -db-max-open-conns is read from ZENTRIX_DB_MAX_OPEN_CONNS.
+const envPrefix = "ZENTRIX_"
+
+// legacyEnv maps flag names to environment variables that were read
+// before the ZENTRIX_ prefix existed.
+var legacyEnv = map[string]string{
+	"db-dsn": "DSN",
+}
+
+// secretFlags are redacted when the effective configuration is printed.
+var secretFlags = map[string]bool{
+	"db-dsn":        true,
+	"smtp-password": true,
+	"metrics-token": true,
+}
+
+var dsnPasswordRX = regexp.MustCompile(`password=\S+`)
+
+// stringList is a flag.Value holding a space or comma separated list.
+// Setting it replaces the previous value so later layers override
+// earlier ones instead of appending to them.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = strings.Fields(strings.ReplaceAll(value, ",", " "))
+	return nil
+}
+
+// loadConfig builds the application configuration from, in increasing
+// order of precedence: built-in defaults, an optional YAML or TOML file,
+// environment variables and command-line flags.
+func loadConfig(args []string) (config, *flag.FlagSet, error) {
+	var cfg config
+	var configFile string
+
+	fs := flag.NewFlagSet("zentrix", flag.ContinueOnError)
+
+	fs.StringVar(&configFile, "config", "", "Path to a YAML or TOML config file")
+
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	fs.TextVar(&cfg.logLevel, "log-level", slog.LevelInfo, "Minimum log level (debug|info|warn|error)")
+
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+
+	fs.StringVar(&cfg.admin.email, "admin-email", "", "Email of a registered user to make an admin at startup")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable per-IP rate limiter")
+	fs.IntVar(&cfg.limiter.requests, "limiter-requests", 100, "Rate limiter maximum requests per window")
+	fs.DurationVar(&cfg.limiter.window, "limiter-window", time.Minute, "Rate limiter window length")
+
+	cfg.cors.trustedOrigins = stringList{"http://localhost:5173", "http://127.0.0.1:5173"}
+	fs.Var(&cfg.cors.trustedOrigins, "cors-trusted-origins", "Trusted CORS origins (space separated)")
+
+	fs.DurationVar(&cfg.timeouts.read, "timeout-read", 5*time.Second, "HTTP server read timeout")
+	fs.DurationVar(&cfg.timeouts.write, "timeout-write", 5*time.Second, "HTTP server write timeout")
+	fs.DurationVar(&cfg.timeouts.idle, "timeout-idle", time.Minute, "HTTP server idle timeout")
+	fs.DurationVar(&cfg.timeouts.handler, "timeout-handler", 60*time.Second, "Per-request handler timeout")
+	fs.DurationVar(&cfg.timeouts.shutdown, "timeout-shutdown", 30*time.Second, "Graceful shutdown deadline")
+	fs.DurationVar(&cfg.timeouts.drain, "timeout-drain", 5*time.Second, "How long /readyz reports not-ready before shutdown starts")
+
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Zentrix <no-reply@zentrix.local>", "SMTP sender")
+
+	fs.BoolVar(&cfg.metrics.enabled, "metrics-enabled", true, "Expose Prometheus metrics at /metrics")
+	fs.StringVar(&cfg.metrics.addr, "metrics-addr", ":9090", "Separate listen address for /metrics; empty serves it on the API listener, which requires metrics-token")
+	fs.StringVar(&cfg.metrics.token, "metrics-token", "", "Bearer token required to scrape /metrics")
+
+	fs.StringVar(&cfg.tracing.exporter, "tracing-exporter", "none", "Trace exporter (none|stdout|otlp)")
+	fs.StringVar(&cfg.tracing.otlpEndpoint, "tracing-otlp-endpoint", "localhost:4318", "OTLP/HTTP collector host:port")
+	fs.BoolVar(&cfg.tracing.otlpInsecure, "tracing-otlp-insecure", false, "Send OTLP traces over plain HTTP")
+	fs.Float64Var(&cfg.tracing.sampleRatio, "tracing-sample-ratio", 1, "Fraction of new traces to sample (0-1)")
+
+	fs.DurationVar(&cfg.tokens.activationTTL, "token-activation-ttl", 3*24*time.Hour, "Activation token lifetime")
+	fs.DurationVar(&cfg.tokens.authenticationTTL, "token-authentication-ttl", 24*time.Hour, "Authentication token lifetime")
+
+	fs.BoolVar(&cfg.api.legacyRoutes, "api-legacy-routes", true, "Also serve /v1 at the root as deprecated unversioned routes")
+	fs.TextVar(&cfg.api.legacySunset, "api-legacy-sunset", time.Time{}, "RFC 3339 time after which unversioned routes are removed, sent as the Sunset header")
+
+	fs.IntVar(&cfg.trash.retentionDays, "trash-retention-days", 0, "Days deleted records stay in the trash before they are purged (0 keeps them forever)")
+	fs.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often expired trash is purged")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if configFile == "" {
+		configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+
+		for name, value := range values {
+			if fs.Lookup(name) == nil || name == "config" {
+				return cfg, nil, fmt.Errorf("config file %s: unknown key %q", configFile, name)
+			}
+
+			if explicit[name] {
+				continue
+			}
+
+			err := fs.Set(name, value)
+			if err != nil {
+				return cfg, nil, fmt.Errorf("config file %s: invalid value for %q: %w", configFile, name, err)
+			}
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "config" || envErr != nil {
+			return
+		}
+
+		key := envName(f.Name)
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			key, ok = legacyEnv[f.Name]
+			if !ok {
+				return
+			}
+
+			value, ok = os.LookupEnv(key)
+			if !ok {
+				return
+			}
+		}
+
+		err := f.Value.Set(value)
+		if err != nil {
+			envErr = fmt.Errorf("environment variable %s: %w", key, err)
+		}
+	})
+	if envErr != nil {
+		return cfg, nil, envErr
+	}
+
+	v := validator.New()
+	if validateConfig(v, cfg); !v.Valid() {
+		keys := make([]string, 0, len(v.Errors))
+		for key := range v.Errors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		msgs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", key, v.Errors[key]))
+		}
+
+		return cfg, nil, errors.New("invalid configuration: " + strings.Join(msgs, "; "))
+	}
+
+	return cfg, fs, nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfigFile reads a YAML or TOML file and flattens nested tables into
+// flag names, so that
+//
+//	db:
+//	  max-open-conns: 50
+//
+// sets -db-max-open-conns. Underscores in keys are accepted as well.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", raw, values)
+
+	return values, nil
+}
+
+func flattenConfig(prefix string, raw map[string]any, values map[string]string) {
+	for key, value := range raw {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flattenConfig(name, value, values)
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, " ")
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+}
+
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.PermittedValues(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+
+	if cfg.admin.email != "" {
+		v.Check(validator.Matches(cfg.admin.email, validator.EmailRX), "admin-email", "must be a valid email address")
+	}
+	v.Check(cfg.db.maxOpenConns > 0, "db-max-open-conns", "must be greater than 0")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleConns <= cfg.db.maxOpenConns, "db-max-idle-conns", "must not exceed db-max-open-conns")
+	v.Check(cfg.db.maxIdleTime > 0, "db-max-idle-time", "must be greater than 0")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.requests > 0, "limiter-requests", "must be greater than 0")
+		v.Check(cfg.limiter.window > 0, "limiter-window", "must be greater than 0")
+	}
+
+	v.Check(len(cfg.cors.trustedOrigins) > 0, "cors-trusted-origins", "must contain at least one origin")
+	for _, origin := range cfg.cors.trustedOrigins {
+		if origin == "*" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			v.AddError("cors-trusted-origins", fmt.Sprintf("invalid origin %q", origin))
+		}
+	}
+
+	v.Check(cfg.timeouts.read > 0, "timeout-read", "must be greater than 0")
+	v.Check(cfg.timeouts.write > 0, "timeout-write", "must be greater than 0")
+	v.Check(cfg.timeouts.idle > 0, "timeout-idle", "must be greater than 0")
+	v.Check(cfg.timeouts.handler > 0, "timeout-handler", "must be greater than 0")
+	v.Check(cfg.timeouts.shutdown > 0, "timeout-shutdown", "must be greater than 0")
+	v.Check(cfg.timeouts.drain >= 0, "timeout-drain", "must not be negative")
+
+	if cfg.smtp.host != "" {
+		v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+
+		_, err := mail.ParseAddress(cfg.smtp.sender)
+		v.Check(err == nil, "smtp-sender", "must be a valid email address")
+	}
+
+	if cfg.metrics.enabled && cfg.metrics.addr != "" {
+		_, port, err := net.SplitHostPort(cfg.metrics.addr)
+		v.Check(err == nil && port != "", "metrics-addr", "must be a host:port address")
+		v.Check(port != strconv.Itoa(cfg.port), "metrics-addr", "must not use the API port")
+	}
+
+	if cfg.metrics.enabled && cfg.metrics.addr == "" {
+		v.Check(cfg.metrics.token != "", "metrics-token", "must be provided when metrics are served on the API listener")
+	}
+
+	v.Check(validator.PermittedValues(cfg.tracing.exporter, "none", "stdout", "otlp"), "tracing-exporter", "must be none, stdout or otlp")
+	if cfg.tracing.exporter == "otlp" {
+		_, _, err := net.SplitHostPort(cfg.tracing.otlpEndpoint)
+		v.Check(err == nil, "tracing-otlp-endpoint", "must be a host:port address")
+	}
+	v.Check(cfg.tracing.sampleRatio >= 0 && cfg.tracing.sampleRatio <= 1, "tracing-sample-ratio", "must be between 0 and 1")
+
+	v.Check(cfg.tokens.activationTTL > 0, "token-activation-ttl", "must be greater than 0")
+	v.Check(cfg.tokens.authenticationTTL > 0, "token-authentication-ttl", "must be greater than 0")
+
+	if !cfg.api.legacySunset.IsZero() {
+		v.Check(cfg.api.legacySunset.After(legacyRoutesDeprecatedAt), "api-legacy-sunset", "must be after the deprecation date")
+	}
+
+	v.Check(cfg.trash.retentionDays >= 0, "trash-retention-days", "must not be negative")
+	v.Check(cfg.trash.purgeInterval > 0, "trash-purge-interval", "must be greater than 0")
+}
+
+// effectiveConfig returns a log attribute for every setting, in flag name
+// order, with secrets redacted.
+func effectiveConfig(fs *flag.FlagSet) []any {
+	var attrs []any
+
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+
+		if secretFlags[f.Name] && value != "" {
+			value = redact(f.Name, value)
+		}
+
+		attrs = append(attrs, slog.String(f.Name, value))
+	})
+
+	return attrs
+}
+
+func redact(name, value string) string {
+	if name != "db-dsn" {
+		return "xxxxx"
+	}
+
+	u, err := url.Parse(value)
+	if err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+
+	return dsnPasswordRX.ReplaceAllString(value, "password=xxxxx")
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -16,14 +19,16 @@ func (app application) createContactHandler(w http.ResponseWriter, r *http.Reque
 	var input struct {
 		Name      string `json:"name"`
 		Email     string `json:"email"`
-		CompanyID string `json:"company_id"`
+		CompanyID string `json:"company_id" validate:"required,uuid"`
 		Title     string `json:"title"`
 		Status    string `json:"status"`
+		// CustomFields maps custom field keys to values.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -36,38 +41,50 @@ func (app application) createContactHandler(w http.ResponseWriter, r *http.Reque
 		Status: input.Status,
 	}
 
-	v.ValidateUUID(input.CompanyID, "company_id")
+	v.Struct(input)
+
+	contact.CustomFields = data.CustomFields{}
+	contact.CustomFields.Apply(input.CustomFields)
+
+	err = app.validateCustomFields(r.Context(), "contacts", contact.CustomFields, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	contact.ValidateContact(v)
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	companyID := uuid.MustParse(input.CompanyID)
 	contact.CompanyID = &companyID
 
-	err = app.models.Contacts.Insert(contact)
+	err = app.models.Contacts.Insert(r.Context(), contact)
 	if err != nil {
 
 		switch {
 		case errors.Is(err, data.ErrInvalidUUID):
 			v.AddError("company_id", "invalid ID")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "email already in use")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	app.metrics.contactsCreated.Inc()
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/contacts/%s", contact.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/contacts/%s", contact.ID))
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"data": contact}, headers)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
@@ -80,17 +97,17 @@ func (app application) getContactByIDHandler(w http.ResponseWriter, r *http.Requ
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	contact, err := app.models.Contacts.GetByIDWithCompanyName(uuid.MustParse(IDParam))
+	contact, err := app.models.Contacts.GetByIDWithCompanyName(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "contact not found")
+			app.notFoundResponse(w, r, "contact")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
@@ -98,23 +115,84 @@ func (app application) getContactByIDHandler(w http.ResponseWriter, r *http.Requ
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": contact}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app application) listContactsHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		CompanyID *uuid.UUID
-		data.Filters
+	qs, ok := app.listQuery(w, r, "contacts")
+	if !ok {
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAll(r.Context(), "contacts")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	qs := r.URL.Query()
+	filters := app.contactListFilters(r, qs, fields, v)
+
+	// vCard files hold whole contacts, so they have no columns or language.
+	vcf := exportFormat(r, qs) == "vcf"
+
+	var columns []exportColumn[*data.ContactWithCompanyName]
+	var download *export[*data.ContactWithCompanyName]
+	if !vcf {
+		columns = readColumns(qs, contactExportColumns, v)
+		download = readExport(r, qs, columns, v)
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if vcf {
+		app.exportVCards(w, r, filters)
+		return
+	}
+
+	if download != nil {
+		exportRows(app, w, r, "contacts", download, func(ctx context.Context, fn func(*data.ContactWithCompanyName) error) error {
+			return app.models.Contacts.Export(ctx, filters, fn)
+		})
+		return
+	}
+
+	contacts, metadata, err := app.models.Contacts.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := pickColumns(contacts, qs, columns)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": records, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// contactListFilters reads the list parameters of GET /contacts, including
+// filters and sorts on the entity's custom fields.
+func (app application) contactListFilters(r *http.Request, qs url.Values, fields []*data.CustomField, v *validator.Validator) data.Filters {
+	var filters data.Filters
 
-	input.Page = app.readInt(qs, "page", 1, v)
-	input.PageSize = app.readInt(qs, "page_size", 10, v)
-	input.Sort = app.readString(qs, "sort", "-created_at")
-	input.SortSafeList =
+	app.readPage(qs, &filters, v)
+	filters.Search = app.readString(qs, "q", "")
+
+	defaultSort := "-created_at"
+	if filters.Search != "" {
+		defaultSort = "-relevance"
+	}
+	filters.Sort = app.readString(qs, "sort", defaultSort)
+	filters.SortSafeList =
 		[]string{
 			"id",
 			"name",
@@ -134,32 +212,15 @@ func (app application) listContactsHandler(w http.ResponseWriter, r *http.Reques
 			"-updated_at",
 		}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
-		return
+	if filters.Search != "" {
+		filters.SortSafeList = append(filters.SortSafeList, "-relevance")
 	}
 
-	if qs.Has("company_id") {
-		companyID, err := uuid.Parse(qs.Get("company_id"))
-		if err != nil {
-			input.CompanyID = nil
-		} else {
-			input.CompanyID = &companyID
-		}
-	}
+	filters.FilterSafeList = data.ContactFilterFields
+	filters.AddCustomFields("c", fields)
+	app.readConditions(r, qs, &filters, v)
 
-	contacts, metadata, err := app.models.Contacts.GetAll(input.Filters, input.CompanyID)
-	if err != nil {
-		fmt.Println(err)
-
-		app.serverErrorResponse(w, err)
-		return
-	}
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"data": contacts, "metadata": metadata}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, err)
-	}
+	return filters
 }
 
 func (app application) updateContactHandler(w http.ResponseWriter, r *http.Request) {
@@ -168,19 +229,21 @@ func (app application) updateContactHandler(w http.ResponseWriter, r *http.Reque
 	var input struct {
 		Name      *string `json:"name"`
 		Email     *string `json:"email"`
-		CompanyID *string `json:"company_id"`
+		CompanyID *string `json:"company_id" validate:"uuid"`
 		Title     *string `json:"title"`
 		Status    *string `json:"status"`
+		// CustomFields sets the custom fields given; null clears one.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	if app.isAllNil(input) {
-		app.badRequestResponse(w, errors.New("body must not be empty"))
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
 		return
 	}
 
@@ -189,17 +252,15 @@ func (app application) updateContactHandler(w http.ResponseWriter, r *http.Reque
 	// Validate UUIDs
 	v.Check(IDParam != "", "id", "id is required")
 	v.ValidateUUID(IDParam, "id")
-	if input.CompanyID != nil {
-		v.ValidateUUID(*input.CompanyID, "company_id")
-	}
+	v.Struct(input)
 
-	contact, err := app.models.Contacts.GetByID(uuid.MustParse(IDParam))
+	contact, err := app.models.Contacts.GetByID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "contact not found")
+			app.notFoundResponse(w, r, "contact")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -225,27 +286,35 @@ func (app application) updateContactHandler(w http.ResponseWriter, r *http.Reque
 		contact.Status = *input.Status
 	}
 
+	if input.CustomFields != nil {
+		contact.CustomFields.Apply(input.CustomFields)
+
+		err = app.validateCustomFields(r.Context(), "contacts", contact.CustomFields, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	contact.ValidateContact(v)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Contacts.Update(contact)
+	err = app.models.Contacts.Update(r.Context(), contact)
 	if err != nil {
-		fmt.Println(err)
-
 		switch {
 		case errors.Is(err, data.ErrInvalidUUID):
 			v.AddError("company_id", "invalid company id")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "email already in use")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
@@ -253,7 +322,7 @@ func (app application) updateContactHandler(w http.ResponseWriter, r *http.Reque
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": contact}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 
 }
@@ -265,24 +334,120 @@ func (app application) deleteContactHandler(w http.ResponseWriter, r *http.Reque
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err := app.models.Contacts.Delete(uuid.MustParse(IDParam))
+	err := app.models.Contacts.Delete(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "contact not found")
+			app.notFoundResponse(w, r, "contact")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
 	}
 
+	app.metrics.contactsDeleted.Inc()
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "contact deleted successfully"}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxMergeContacts is how many duplicates one merge may fold in.
+const maxMergeContacts = 50
+
+// mergeContactHandler merges duplicate_ids into the contact in the URL,
+// which survives. winners picks, per field, the contact whose value is
+// kept. With preview set nothing is saved and the response shows what the
+// merge would do. Users other than admins must be the sales owner of every
+// contact's company.
+func (app application) mergeContactHandler(w http.ResponseWriter, r *http.Request) {
+	IDParam := chi.URLParam(r, "id")
+
+	var input struct {
+		DuplicateIDs []string          `json:"duplicate_ids"`
+		Winners      map[string]string `json:"winners"`
+		Preview      bool              `json:"preview"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+	v.Check(len(input.DuplicateIDs) > 0, "duplicate_ids", "must contain at least one id")
+	v.Check(len(input.DuplicateIDs) <= maxMergeContacts, "duplicate_ids", fmt.Sprintf("must not contain more than %d ids", maxMergeContacts))
+
+	// IDs are compared parsed, as the same ID can be written differently.
+	seen := map[uuid.UUID]bool{}
+	if ID, err := uuid.Parse(IDParam); err == nil {
+		seen[ID] = true
+	}
+
+	for _, raw := range input.DuplicateIDs {
+		ID, err := uuid.Parse(raw)
+		if err != nil {
+			v.AddError("duplicate_ids", "invalid ID")
+			continue
+		}
+		v.Check(!seen[ID], "duplicate_ids", "must be unique and not include the contact being merged into")
+		seen[ID] = true
+	}
+
+	for field, raw := range input.Winners {
+		ID, err := uuid.Parse(raw)
+		v.Check(slices.Contains(data.ContactMergeFields, field), "winners", fmt.Sprintf("%s is not a mergeable field", field))
+		v.Check(err == nil && seen[ID], "winners."+field, "must be the id of one of the merged contacts")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicateIDs := make([]uuid.UUID, len(input.DuplicateIDs))
+	for i, ID := range input.DuplicateIDs {
+		duplicateIDs[i] = uuid.MustParse(ID)
+	}
+
+	winners := make(map[string]uuid.UUID, len(input.Winners))
+	for field, ID := range input.Winners {
+		winners[field] = uuid.MustParse(ID)
+	}
+
+	user := app.contextGetUser(r)
+
+	var owner *uuid.UUID
+	if user.Role != data.RoleAdmin {
+		owner = &user.ID
+	}
+
+	contact, merge, err := app.models.Contacts.Merge(r.Context(), uuid.MustParse(IDParam), duplicateIDs, winners, owner, user.ID, input.Preview)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "contact")
+		case errors.Is(err, data.ErrNotPermitted):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": contact, "merge": merge}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+)
+
+type contextKey string
+
+const (
+	userContextKey        = contextKey("user")
+	requestInfoContextKey = contextKey("request_info")
+)
+
+// requestInfo is stored in the request context by logRequests before any
+// other middleware runs. It is a pointer so that values discovered further
+// down the chain, such as the authenticated user, are visible to the
+// request log line written on the way back out.
+type requestInfo struct {
+	start  time.Time
+	userID string
+}
+
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info := contextGetRequestInfo(r.Context()); info != nil && !user.IsAnonymous() {
+		info.userID = user.ID.String()
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		return data.AnonymousUser
+	}
+
+	return user
+}
+
+func contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+func contextGetRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// createCustomFieldHandler defines a custom field. Only admins may define
+// custom fields.
+func (app application) createCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Entity    string   `json:"entity"`
+		Key       string   `json:"key"`
+		Label     string   `json:"label"`
+		Type      string   `json:"type"`
+		Options   []string `json:"options"`
+		Reference string   `json:"reference"`
+		Required  bool     `json:"required"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	field := &data.CustomField{
+		Entity:    input.Entity,
+		Key:       input.Key,
+		Label:     input.Label,
+		Type:      input.Type,
+		Options:   input.Options,
+		Reference: input.Reference,
+		Required:  input.Required,
+	}
+
+	if field.Options == nil {
+		field.Options = []string{}
+	}
+
+	v := validator.New()
+
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.CustomFields.Insert(r.Context(), field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateKey):
+			v.AddError("key", fmt.Sprintf("a custom field with this key already exists on %s", field.Entity))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/custom-fields/%s", field.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCustomFieldsHandler lists the custom fields of ?entity=, or of every
+// entity.
+func (app application) listCustomFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	entity := app.readString(r.URL.Query(), "entity", "")
+
+	v := validator.New()
+
+	if entity != "" {
+		v.Check(validator.PermittedValues(entity, data.CustomFieldEntities...), "entity", "must be one of: "+strings.Join(data.CustomFieldEntities, ", "))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAll(r.Context(), entity)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": fields}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCustomField loads the custom field named by the id URL parameter,
+// writing the error response and returning nil if it is invalid or
+// missing.
+func (app application) readCustomField(w http.ResponseWriter, r *http.Request) *data.CustomField {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	field, err := app.models.CustomFields.GetByID(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "custom field")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return field
+}
+
+func (app application) getCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	field := app.readCustomField(w, r)
+	if field == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"data": field}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCustomFieldHandler changes a custom field's label, options and
+// whether it is required. Values already stored are only checked again
+// when their record's custom fields are next written. Only admins may
+// update custom fields.
+func (app application) updateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	field := app.readCustomField(w, r)
+	if field == nil {
+		return
+	}
+
+	var input struct {
+		Label    *string   `json:"label"`
+		Options  *[]string `json:"options"`
+		Required *bool     `json:"required"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.isAllNil(input) {
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
+		return
+	}
+
+	if input.Label != nil {
+		field.Label = *input.Label
+	}
+
+	if input.Options != nil {
+		field.Options = *input.Options
+	}
+
+	if input.Required != nil {
+		field.Required = *input.Required
+	}
+
+	v := validator.New()
+
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.CustomFields.Update(r.Context(), field)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "custom field")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": field}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCustomFieldHandler deletes a custom field along with its values.
+// Only admins may delete custom fields.
+func (app application) deleteCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	field := app.readCustomField(w, r)
+	if field == nil {
+		return
+	}
+
+	err := app.models.CustomFields.Delete(r.Context(), field.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "custom field")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "custom field deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateCustomFields checks a record's custom field values against the
+// fields defined on its entity, adding any problems to v, and converts
+// them in place to how they are stored.
+func (app application) validateCustomFields(ctx context.Context, entity string, values data.CustomFields, v *validator.Validator) error {
+	fields, err := app.models.CustomFields.GetAll(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	if data.ValidateCustomFields(v, fields, values); !v.Valid() {
+		return nil
+	}
+
+	missing, err := app.models.CustomFields.MissingReferences(ctx, fields, values)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range missing {
+		v.AddError("custom_fields."+key, "must reference an existing record")
+	}
+
+	return nil
+}
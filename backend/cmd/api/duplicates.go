@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// detectDuplicatesHandler starts a duplicate detection run in the
+// background. It scans every company, so only admins may start one.
+func (app application) detectDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	app.background(func(ctx context.Context) {
+		found, err := app.models.Companies.DetectDuplicates(ctx)
+		if err != nil {
+			app.logger.Error("duplicate detection failed", "error", err)
+			return
+		}
+
+		app.logger.Info("duplicate detection finished", "pairs", found)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", "/v1/companies/duplicates")
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"message": "duplicate detection started"}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listDuplicatesHandler lists the pairs found by the last detection run.
+// Users other than admins only see pairs of companies they own.
+func (app application) listDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 10, v),
+		Sort:         "-score",
+		SortSafeList: []string{"-score"},
+	}
+	minScore := app.readFloat(qs, "min_score", data.DuplicateThreshold, v)
+
+	v.Check(minScore >= 0 && minScore <= 1, "min_score", "must be between 0 and 1")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var owner *uuid.UUID
+	if user := app.contextGetUser(r); user.Role != data.RoleAdmin {
+		owner = &user.ID
+	}
+
+	duplicates, metadata, err := app.models.Companies.GetDuplicates(r.Context(), owner, minScore, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": duplicates, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeCompanyHandler merges the company in the body into the one in the
+// URL, which survives. fields lists the fields to take from the duplicate;
+// the rest keep the survivor's values. Users other than admins must be
+// the sales owner of both companies.
+func (app application) mergeCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	IDParam := chi.URLParam(r, "id")
+
+	var input struct {
+		DuplicateID string   `json:"duplicate_id"`
+		Fields      []string `json:"fields"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+	v.ValidateUUID(input.DuplicateID, "duplicate_id")
+
+	for _, field := range input.Fields {
+		if !slices.Contains(data.CompanyMergeFields, field) {
+			v.AddError("fields", fmt.Sprintf("%s is not a mergeable field", field))
+			break
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	survivorID, duplicateID := uuid.MustParse(IDParam), uuid.MustParse(input.DuplicateID)
+	if survivorID == duplicateID {
+		v.AddError("duplicate_id", "must not be the company being merged into")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	for _, ID := range []uuid.UUID{survivorID, duplicateID} {
+		company, err := app.models.Companies.GetByID(r.Context(), ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				app.notFoundResponse(w, r, "company")
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if user.Role != data.RoleAdmin && company.SalesOwner != user.ID {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	merge, err := app.models.Companies.Merge(r.Context(), survivorID, duplicateID, slices.Compact(slices.Sorted(slices.Values(input.Fields))), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "company")
+		case errors.Is(err, data.ErrSelfMerge):
+			v.AddError("duplicate_id", "must not be the company being merged into")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	company, err := app.models.Companies.GetByIDWithSalesOwner(r.Context(), survivorID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": company, "merge": merge}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,30 +1,280 @@
 package main
 
-import "net/http"
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
 
-func (app application) errorResponse(w http.ResponseWriter, status int, message any) {
-	env := envelope{"error": message}
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 
-	err := app.writeJSON(w, status, env, nil)
+	"github.com/kharljhon14/zentrix/internal/data"
+)
+
+// Stable, machine-readable error codes. Clients should branch on these
+// rather than on the human-readable detail.
+const (
+	codeBadRequest          = "bad_request"
+	codeValidationFailed    = "validation_failed"
+	codeNotFound            = "not_found"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeRateLimited         = "rate_limited"
+	codeInvalidToken        = "invalid_authentication_token"
+	codeInvalidCredentials  = "invalid_credentials"
+	codeAuthRequired        = "authentication_required"
+	codeInactiveAccount     = "inactive_account"
+	codeNotPermitted        = "not_permitted"
+	codeHasDependents       = "company_has_dependents"
+	codeParentInTrash       = "parent_in_trash"
+	codeUnsupportedVersion  = "unsupported_api_version"
+	codeInternalServerError = "internal_server_error"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details object extended with a stable
+// error code, for validation failures a list of field errors and, when a
+// company can't be deleted, what depends on it.
+type problem struct {
+	Type       string                  `json:"type"`
+	Title      string                  `json:"title"`
+	Status     int                     `json:"status"`
+	Detail     string                  `json:"detail,omitempty"`
+	Instance   string                  `json:"instance,omitempty"`
+	Code       string                  `json:"code"`
+	Errors     []fieldError            `json:"errors,omitempty"`
+	Dependents *data.CompanyDependents `json:"dependents,omitempty"`
+	Parent     *problemParent          `json:"parent,omitempty"`
+}
+
+// problemParent is the deleted record that kept another from being
+// restored.
+type problemParent struct {
+	Type string    `json:"type"`
+	ID   uuid.UUID `json:"id"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (app application) logError(r *http.Request, err error) {
+	app.logger.ErrorContext(r.Context(), err.Error(),
+		"method", r.Method,
+		"uri", r.URL.RequestURI(),
+		"trace", string(debug.Stack()),
+	)
+}
+
+// wantsLegacyErrors reports whether r should get the old {"error": ...}
+// envelope. Only the unversioned routes, whose clients predate problem
+// details, do so, and even there a client can opt in to problem+json
+// through Accept. Versioned routes always get problem details.
+func wantsLegacyErrors(r *http.Request) bool {
+	if versionedPath(r.URL.Path) {
+		return false
+	}
+
+	for part := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == problemContentType {
+			return false
+		}
+	}
+
+	return true
+}
+
+// errorResponse writes a problem+json body, or the legacy error envelope
+// when the client negotiated for it. legacy is what older clients saw
+// under the "error" key.
+func (app application) errorResponse(w http.ResponseWriter, r *http.Request, p problem, legacy any) {
+	if wantsLegacyErrors(r) {
+		err := app.writeJSON(w, p.Status, envelope{"error": legacy}, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	p.Type = "urn:zentrix:problem:" + p.Code
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Instance = middleware.GetReqID(r.Context())
+
+	js, err := json.Marshal(p)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(js)
 }
 
-func (app application) serverErrorResponse(w http.ResponseWriter, err error) {
+func (app application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, problem{
+		Status: http.StatusInternalServerError,
+		Detail: message,
+		Code:   codeInternalServerError,
+	}, message)
 }
 
-func (app application) notFoundResponse(w http.ResponseWriter, message string) {
-	app.errorResponse(w, http.StatusNotFound, message)
+// notFoundResponse reports that resource (e.g. "company") doesn't exist.
+// The code is specific to the resource, e.g. "company_not_found".
+func (app application) notFoundResponse(w http.ResponseWriter, r *http.Request, resource string) {
+	message := fmt.Sprintf("%s not found", resource)
+	app.errorResponse(w, r, problem{
+		Status: http.StatusNotFound,
+		Detail: message,
+		Code:   strings.ReplaceAll(resource, " ", "_") + "_not_found",
+	}, message)
 }
 
-func (app application) badRequestResponse(w http.ResponseWriter, err error) {
-	app.errorResponse(w, http.StatusBadRequest, err.Error())
+func (app application) routeNotFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusNotFound,
+		Detail: message,
+		Code:   codeNotFound,
+	}, message)
 }
 
-func (app application) failedValidationResponse(w http.ResponseWriter, errors map[string]string) {
-	app.errorResponse(w, http.StatusUnprocessableEntity, errors)
+func (app application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	app.errorResponse(w, r, problem{
+		Status: http.StatusMethodNotAllowed,
+		Detail: message,
+		Code:   codeMethodNotAllowed,
+	}, message)
+}
+
+func (app application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, problem{
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+		Code:   codeBadRequest,
+	}, err.Error())
+}
+
+func (app application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	fields := make([]fieldError, 0, len(errors))
+	for _, field := range slices.Sorted(maps.Keys(errors)) {
+		fields = append(fields, fieldError{Field: field, Message: errors[field]})
+	}
+
+	app.errorResponse(w, r, problem{
+		Status: http.StatusUnprocessableEntity,
+		Detail: "one or more fields failed validation",
+		Code:   codeValidationFailed,
+		Errors: fields,
+	}, errors)
+}
+
+func (app application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	app.metrics.rateLimited.Inc()
+
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusTooManyRequests,
+		Detail: message,
+		Code:   codeRateLimited,
+	}, message)
+}
+
+func (app application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusUnauthorized,
+		Detail: message,
+		Code:   codeInvalidToken,
+	}, message)
+}
+
+func (app application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusUnauthorized,
+		Detail: message,
+		Code:   codeInvalidCredentials,
+	}, message)
+}
+
+func (app application) unsupportedVersionResponse(w http.ResponseWriter, r *http.Request, requested string) {
+	message := fmt.Sprintf("API version %q is not served here; supported versions: %s", requested, strings.Join(apiVersions, ", "))
+	if slices.Contains(apiVersions, requested) {
+		message = fmt.Sprintf("API version %q is served under /%s", requested, requested)
+	}
+
+	app.errorResponse(w, r, problem{
+		Status: http.StatusNotAcceptable,
+		Detail: message,
+		Code:   codeUnsupportedVersion,
+	}, message)
+}
+
+func (app application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusUnauthorized,
+		Detail: message,
+		Code:   codeAuthRequired,
+	}, message)
+}
+
+func (app application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusForbidden,
+		Detail: message,
+		Code:   codeInactiveAccount,
+	}, message)
+}
+
+func (app application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, problem{
+		Status: http.StatusForbidden,
+		Detail: message,
+		Code:   codeNotPermitted,
+	}, message)
+}
+
+// hasDependentsResponse reports that a company still has the dependents
+// and the client didn't say what to do with them.
+func (app application) hasDependentsResponse(w http.ResponseWriter, r *http.Request, dependents data.CompanyDependents) {
+	message := "company has contacts, quotes or projects; delete them with dependents=cascade or move them with dependents=reassign"
+	app.errorResponse(w, r, problem{
+		Status:     http.StatusConflict,
+		Detail:     message,
+		Code:       codeHasDependents,
+		Dependents: &dependents,
+	}, message)
+}
 
+// parentInTrashResponse reports that a record of entity can't be restored
+// until the record it refers to is.
+func (app application) parentInTrashResponse(w http.ResponseWriter, r *http.Request, entity string, parent *data.DeletedParentError) {
+	message := fmt.Sprintf("the %s's %s %s is in the trash; restore it first", trashNames[entity], trashNames[parent.Entity], parent.ID)
+	app.errorResponse(w, r, problem{
+		Status: http.StatusConflict,
+		Detail: message,
+		Code:   codeParentInTrash,
+		Parent: &problemParent{Type: parent.Entity, ID: parent.ID},
+	}, message)
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsLegacyErrors(t *testing.T) {
+	tests := []struct {
+		path   string
+		accept string
+		want   bool
+	}{
+		{"/v1/companies", "", false},
+		{"/v1/companies", "application/json", false},
+		{"/v1", "application/json", false},
+		{"/companies", "", true},
+		{"/companies", "application/json", true},
+		{"/companies", "application/json, application/problem+json", false},
+		{"/v1companies", "application/json", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+
+		if got := wantsLegacyErrors(r); got != tt.want {
+			t.Errorf("wantsLegacyErrors(%s, Accept %q) = %t, want %t", tt.path, tt.accept, got, tt.want)
+		}
+	}
+}
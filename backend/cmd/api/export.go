@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/language"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+	"github.com/kharljhon14/zentrix/internal/vcard"
+)
+
+const (
+	csvMediaType  = "text/csv"
+	xlsxMediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	// exportFlushRows is how many CSV rows are written between flushes to
+	// the client.
+	exportFlushRows = 500
+)
+
+// exportColumn is a column list endpoints can export, named as in JSON.
+type exportColumn[T any] struct {
+	name  string
+	value func(T) any
+}
+
+var companyExportColumns = []exportColumn[*data.CompanyWithSalesOwner]{
+	{"id", func(c *data.CompanyWithSalesOwner) any { return c.ID }},
+	{"name", func(c *data.CompanyWithSalesOwner) any { return c.Name }},
+	{"address", func(c *data.CompanyWithSalesOwner) any { return c.Address }},
+	{"sales_owner", func(c *data.CompanyWithSalesOwner) any { return c.SalesOwner }},
+	{"sales_owner_name", func(c *data.CompanyWithSalesOwner) any { return c.SalesOwnerName }},
+	{"email", func(c *data.CompanyWithSalesOwner) any { return c.Email }},
+	{"company_size", func(c *data.CompanyWithSalesOwner) any { return c.CompanySize }},
+	{"industry", func(c *data.CompanyWithSalesOwner) any { return c.Industry }},
+	{"business_type", func(c *data.CompanyWithSalesOwner) any { return c.BusinessType }},
+	{"country", func(c *data.CompanyWithSalesOwner) any { return c.Country }},
+	{"image", func(c *data.CompanyWithSalesOwner) any { return c.Image }},
+	{"website", func(c *data.CompanyWithSalesOwner) any { return c.Website }},
+	{"parent_id", func(c *data.CompanyWithSalesOwner) any { return c.ParentID }},
+	{"tags", func(c *data.CompanyWithSalesOwner) any { return strings.Join(c.Tags.Names(), ", ") }},
+	{"created_at", func(c *data.CompanyWithSalesOwner) any { return c.CreatedAt }},
+	{"updated_at", func(c *data.CompanyWithSalesOwner) any { return c.UpdatedAt }},
+}
+
+var contactExportColumns = []exportColumn[*data.ContactWithCompanyName]{
+	{"id", func(c *data.ContactWithCompanyName) any { return c.ID }},
+	{"name", func(c *data.ContactWithCompanyName) any { return c.Name }},
+	{"email", func(c *data.ContactWithCompanyName) any { return c.Email }},
+	{"company_id", func(c *data.ContactWithCompanyName) any { return c.CompanyID }},
+	{"company_name", func(c *data.ContactWithCompanyName) any { return c.CompanyName }},
+	{"title", func(c *data.ContactWithCompanyName) any { return c.Title }},
+	{"status", func(c *data.ContactWithCompanyName) any { return c.Status }},
+	{"tags", func(c *data.ContactWithCompanyName) any { return strings.Join(c.Tags.Names(), ", ") }},
+	{"created_at", func(c *data.ContactWithCompanyName) any { return c.CreatedAt }},
+	{"updated_at", func(c *data.ContactWithCompanyName) any { return c.UpdatedAt }},
+}
+
+var quoteExportColumns = []exportColumn[*data.QuoteWithRelationNames]{
+	{"id", func(q *data.QuoteWithRelationNames) any { return q.ID }},
+	{"name", func(q *data.QuoteWithRelationNames) any { return q.Name }},
+	{"company_id", func(q *data.QuoteWithRelationNames) any { return q.CompanyID }},
+	{"company_name", func(q *data.QuoteWithRelationNames) any { return q.CompanyName }},
+	{"sales_tax", func(q *data.QuoteWithRelationNames) any { return q.SalesTax }},
+	{"stage", func(q *data.QuoteWithRelationNames) any { return q.Stage }},
+	{"notes", func(q *data.QuoteWithRelationNames) any { return q.Notes }},
+	{"prepared_by", func(q *data.QuoteWithRelationNames) any { return q.PreparedBy }},
+	{"prepared_by_name", func(q *data.QuoteWithRelationNames) any { return q.PreparedByName }},
+	{"prepared_for", func(q *data.QuoteWithRelationNames) any { return q.PreparedFor }},
+	{"prepared_for_name", func(q *data.QuoteWithRelationNames) any { return q.PreparedForName }},
+	{"tags", func(q *data.QuoteWithRelationNames) any { return strings.Join(q.Tags.Names(), ", ") }},
+	{"created_at", func(q *data.QuoteWithRelationNames) any { return q.CreatedAt }},
+	{"updated_at", func(q *data.QuoteWithRelationNames) any { return q.UpdatedAt }},
+}
+
+// exportLanguages are the languages header rows are translated to. The
+// first is the fallback.
+var exportLanguages = language.NewMatcher([]language.Tag{
+	language.English,
+	language.Spanish,
+	language.French,
+	language.German,
+})
+
+var exportLabels = map[string]map[string]string{
+	"en": {
+		"id":                "ID",
+		"name":              "Name",
+		"address":           "Address",
+		"sales_owner":       "Sales owner ID",
+		"sales_owner_name":  "Sales owner",
+		"email":             "Email",
+		"company_size":      "Company size",
+		"industry":          "Industry",
+		"business_type":     "Business type",
+		"country":           "Country",
+		"image":             "Image",
+		"website":           "Website",
+		"parent_id":         "Parent company ID",
+		"created_at":        "Created",
+		"updated_at":        "Updated",
+		"company_id":        "Company ID",
+		"company_name":      "Company",
+		"title":             "Title",
+		"status":            "Status",
+		"sales_tax":         "Sales tax",
+		"stage":             "Stage",
+		"notes":             "Notes",
+		"prepared_by":       "Prepared by ID",
+		"prepared_by_name":  "Prepared by",
+		"prepared_for":      "Prepared for ID",
+		"prepared_for_name": "Prepared for",
+		"tags":              "Tags",
+	},
+	"es": {
+		"id":                "ID",
+		"name":              "Nombre",
+		"address":           "Dirección",
+		"sales_owner":       "ID del responsable de ventas",
+		"sales_owner_name":  "Responsable de ventas",
+		"email":             "Correo electrónico",
+		"company_size":      "Tamaño de la empresa",
+		"industry":          "Sector",
+		"business_type":     "Tipo de negocio",
+		"country":           "País",
+		"image":             "Imagen",
+		"website":           "Sitio web",
+		"parent_id":         "ID de la empresa matriz",
+		"created_at":        "Creado",
+		"updated_at":        "Actualizado",
+		"company_id":        "ID de la empresa",
+		"company_name":      "Empresa",
+		"title":             "Cargo",
+		"status":            "Estado",
+		"sales_tax":         "Impuesto sobre las ventas",
+		"stage":             "Etapa",
+		"notes":             "Notas",
+		"prepared_by":       "ID de quien lo preparó",
+		"prepared_by_name":  "Preparado por",
+		"prepared_for":      "ID del destinatario",
+		"prepared_for_name": "Preparado para",
+		"tags":              "Etiquetas",
+	},
+	"fr": {
+		"id":                "ID",
+		"name":              "Nom",
+		"address":           "Adresse",
+		"sales_owner":       "ID du responsable commercial",
+		"sales_owner_name":  "Responsable commercial",
+		"email":             "E-mail",
+		"company_size":      "Taille de l'entreprise",
+		"industry":          "Secteur",
+		"business_type":     "Type d'activité",
+		"country":           "Pays",
+		"image":             "Image",
+		"website":           "Site web",
+		"parent_id":         "ID de la société mère",
+		"created_at":        "Créé le",
+		"updated_at":        "Mis à jour le",
+		"company_id":        "ID de l'entreprise",
+		"company_name":      "Entreprise",
+		"title":             "Fonction",
+		"status":            "Statut",
+		"sales_tax":         "Taxe de vente",
+		"stage":             "Étape",
+		"notes":             "Notes",
+		"prepared_by":       "ID du rédacteur",
+		"prepared_by_name":  "Préparé par",
+		"prepared_for":      "ID du destinataire",
+		"prepared_for_name": "Préparé pour",
+		"tags":              "Étiquettes",
+	},
+	"de": {
+		"id":                "ID",
+		"name":              "Name",
+		"address":           "Adresse",
+		"sales_owner":       "Vertriebsverantwortlicher (ID)",
+		"sales_owner_name":  "Vertriebsverantwortlicher",
+		"email":             "E-Mail",
+		"company_size":      "Unternehmensgröße",
+		"industry":          "Branche",
+		"business_type":     "Geschäftsart",
+		"country":           "Land",
+		"image":             "Bild",
+		"website":           "Website",
+		"parent_id":         "Muttergesellschaft (ID)",
+		"created_at":        "Erstellt",
+		"updated_at":        "Aktualisiert",
+		"company_id":        "Unternehmens-ID",
+		"company_name":      "Unternehmen",
+		"title":             "Position",
+		"status":            "Status",
+		"sales_tax":         "Umsatzsteuer",
+		"stage":             "Phase",
+		"notes":             "Notizen",
+		"prepared_by":       "Erstellt von (ID)",
+		"prepared_by_name":  "Erstellt von",
+		"prepared_for":      "Erstellt für (ID)",
+		"prepared_for_name": "Erstellt für",
+		"tags":              "Tags",
+	},
+}
+
+// export holds the choices of a list request that asked for a file.
+type export[T any] struct {
+	format   string
+	columns  []exportColumn[T]
+	language string
+}
+
+// readColumns returns the columns named by ?columns=, in order, or all of
+// them by default.
+func readColumns[T any](qs url.Values, columns []exportColumn[T], v *validator.Validator) []exportColumn[T] {
+	names := qs.Get("columns")
+	if names == "" {
+		return columns
+	}
+
+	var selected []exportColumn[T]
+	for name := range strings.SplitSeq(names, ",") {
+		i := slices.IndexFunc(columns, func(c exportColumn[T]) bool { return c.name == name })
+		if i < 0 {
+			v.AddError("columns", fmt.Sprintf("%s is not an exportable column", name))
+			break
+		}
+		selected = append(selected, columns[i])
+	}
+
+	return selected
+}
+
+// columnNames returns the names of columns.
+func columnNames[T any](columns []exportColumn[T]) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	return names
+}
+
+// pickColumns limits each record of a JSON list to the fields named by
+// ?columns=. Without it the records are returned whole.
+func pickColumns[T any](records []T, qs url.Values, columns []exportColumn[T]) (any, error) {
+	if qs.Get("columns") == "" {
+		return records, nil
+	}
+
+	picked := make([]map[string]json.RawMessage, len(records))
+	for i, record := range records {
+		js, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields map[string]json.RawMessage
+		err = json.Unmarshal(js, &fields)
+		if err != nil {
+			return nil, err
+		}
+
+		picked[i] = make(map[string]json.RawMessage, len(columns))
+		for _, column := range columns {
+			picked[i][column.name] = fields[column.name]
+		}
+	}
+
+	return picked, nil
+}
+
+// readExport reads ?format= and the Accept header and, if they ask for CSV
+// or XLSX rather than JSON, the header language (?lang= or
+// Accept-Language) of an export of columns. It returns nil for JSON.
+func readExport[T any](r *http.Request, qs url.Values, columns []exportColumn[T], v *validator.Validator) *export[T] {
+	format := exportFormat(r, qs)
+	switch format {
+	case "csv", "xlsx":
+	case "", "json":
+		return nil
+	default:
+		v.AddError("format", "must be one of json, csv or xlsx")
+		return nil
+	}
+
+	e := &export[T]{format: format, columns: columns}
+
+	tag, _ := language.MatchStrings(exportLanguages, qs.Get("lang"), r.Header.Get("Accept-Language"))
+	base, _ := tag.Base()
+	e.language = base.String()
+
+	return e
+}
+
+func exportFormat(r *http.Request, qs url.Values) string {
+	if qs.Has("format") {
+		return qs.Get("format")
+	}
+
+	for part := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case csvMediaType:
+			return "csv"
+		case xlsxMediaType:
+			return "xlsx"
+		case vcard.MediaType:
+			return "vcf"
+		case "application/json", "*/*":
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// exportRows writes the rows fetch yields as a file download. The header
+// and rows are only written once fetch yields its first row, so a query
+// that fails straight away still gets an error response. A failure after
+// that aborts the connection rather than leave the client with a
+// truncated file that looks complete.
+func exportRows[T any](app application, w http.ResponseWriter, r *http.Request, entity string, e *export[T], fetch func(context.Context, func(T) error) error) {
+	labels := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		labels[i] = exportLabels[e.language][column.name]
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", entity, time.Now().UTC().Format(time.DateOnly), e.format)
+
+	rc := http.NewResponseController(w)
+	out := deadlineWriter{w: w, rc: rc, timeout: app.config.timeouts.write}
+
+	var table tableWriter
+	begin := func() error {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Content-Language", e.language)
+
+		var err error
+		switch e.format {
+		case "xlsx":
+			w.Header().Set("Content-Type", xlsxMediaType)
+			table, err = newXLSXWriter(out, entity)
+		default:
+			w.Header().Set("Content-Type", csvMediaType+"; charset=utf-8")
+			table, err = newCSVWriter(out, rc)
+		}
+		if err != nil {
+			return err
+		}
+
+		return table.WriteRow(anySlice(labels))
+	}
+
+	// The export outlives the handler timeout; it stops when the client
+	// goes away and writes start failing, or when the query times out.
+	ctx := context.WithoutCancel(r.Context())
+
+	err := fetch(ctx, func(row T) error {
+		if table == nil {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+
+		values := make([]any, len(e.columns))
+		for i, column := range e.columns {
+			values[i] = column.value(row)
+		}
+
+		return table.WriteRow(values)
+	})
+	if err == nil && table == nil {
+		err = begin()
+	}
+	if err == nil {
+		err = table.Close()
+	}
+
+	if err != nil {
+		if table == nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.logError(r, fmt.Errorf("export failed: %w", err))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func anySlice(s []string) []any {
+	values := make([]any, len(s))
+	for i, v := range s {
+		values[i] = v
+	}
+	return values
+}
+
+// tableWriter writes the rows of an export in a file format.
+type tableWriter interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+// deadlineWriter pushes the write deadline back before every write, so a
+// long download only times out when the client stops reading.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	// Not every ResponseWriter supports deadlines, e.g. in tests; writes
+	// then simply run under the server's timeouts.
+	_ = d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+
+	return d.w.Write(p)
+}
+
+type csvWriter struct {
+	w    *csv.Writer
+	rc   *http.ResponseController
+	rows int
+}
+
+// newCSVWriter writes CSV to w, starting with a UTF-8 byte order mark so
+// that Excel doesn't mistake the encoding.
+func newCSVWriter(out io.Writer, rc *http.ResponseController) (*csvWriter, error) {
+	_, err := out.Write([]byte("\uFEFF"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{w: csv.NewWriter(out), rc: rc}, nil
+}
+
+func (c *csvWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatExportValue(value)
+	}
+
+	err := c.w.Write(record)
+	if err != nil {
+		return err
+	}
+
+	c.rows++
+	if c.rows%exportFlushRows == 0 {
+		return c.flush()
+	}
+
+	return nil
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+
+	err := c.rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *csvWriter) Close() error {
+	return c.flush()
+}
+
+func formatExportValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(value)
+	case *string:
+		if value == nil {
+			return ""
+		}
+		return escapeFormula(*value)
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case uuid.UUID:
+		return value.String()
+	case *uuid.UUID:
+		if value == nil {
+			return ""
+		}
+		return value.String()
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	default:
+		return escapeFormula(fmt.Sprint(value))
+	}
+}
+
+// escapeFormula prefixes text that a spreadsheet would run as a formula
+// with a quote, so an exported "=HYPERLINK(...)" shows as typed.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// xlsxWriter writes a single-sheet workbook. The zip format can only be
+// finished after the last row, so rows are spooled by excelize, to a
+// temporary file once they outgrow its memory buffer, and sent on Close.
+type xlsxWriter struct {
+	out       io.Writer
+	file      *excelize.File
+	sheet     *excelize.StreamWriter
+	dateStyle int
+	rows      int
+}
+
+func newXLSXWriter(out io.Writer, sheet string) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+
+	err := file.SetSheetName("Sheet1", sheet)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	sw, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	format := "yyyy-mm-dd hh:mm:ss"
+	dateStyle, err := file.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &xlsxWriter{out: out, file: file, sheet: sw, dateStyle: dateStyle}, nil
+}
+
+func (x *xlsxWriter) WriteRow(values []any) error {
+	cells := make([]any, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case time.Time:
+			cells[i] = excelize.Cell{StyleID: x.dateStyle, Value: value.UTC()}
+		case int:
+			cells[i] = value
+		default:
+			cells[i] = formatExportValue(value)
+		}
+	}
+
+	x.rows++
+
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+
+	return x.sheet.SetRow(cell, cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+
+	err := x.sheet.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = x.file.WriteTo(x.out)
+	return err
+}
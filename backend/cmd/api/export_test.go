@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestFormatExportValueEscapesFormulas(t *testing.T) {
+	formula := "=1+1"
+
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"Acme", "Acme"},
+		{"", ""},
+		{"=HYPERLINK(\"http://evil.test\")", "'=HYPERLINK(\"http://evil.test\")"},
+		{"+63 912 345 6789", "'+63 912 345 6789"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{&formula, "'=1+1"},
+		{-5, "-5"},
+		{-1.5, "-1.5"},
+	}
+
+	for _, tt := range tests {
+		if got := formatExportValue(tt.value); got != tt.want {
+			t.Errorf("formatExportValue(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,15 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kharljhon14/zentrix/internal/db"
+)
 
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -12,6 +21,116 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 
 	err := app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// livezHandler reports that the process is up and serving HTTP. It never
+// touches dependencies so a slow database can't get the pod restarted.
+func (app *application) livezHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "ok"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type dependencyStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// readyzHandler reports whether the instance should receive traffic. It
+// checks every configured dependency and fails while the server is
+// draining during shutdown.
+func (app *application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if app.shuttingDown.Load() {
+		err := app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "shutting_down"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	checks := map[string]func(context.Context) (string, error){
+		"database":   app.checkDatabase,
+		"migrations": app.checkMigrations,
+	}
+
+	if app.config.smtp.host != "" {
+		checks["mailer"] = app.checkMailer
+	}
+
+	status := http.StatusOK
+	dependencies := make(map[string]dependencyStatus, len(checks))
+
+	for name, check := range checks {
+		start := time.Now()
+		detail, err := check(r.Context())
+
+		dep := dependencyStatus{
+			Status:  "ok",
+			Latency: time.Since(start).String(),
+			Detail:  detail,
+		}
+
+		if err != nil {
+			dep.Status = "unavailable"
+			dep.Detail = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+
+		dependencies[name] = dep
+	}
+
+	env := envelope{
+		"status":       "ready",
+		"dependencies": dependencies,
+	}
+	if status != http.StatusOK {
+		env["status"] = "not_ready"
+	}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkDatabase(ctx context.Context) (string, error) {
+	return "", app.models.Schema.Ping(ctx)
+}
+
+func (app *application) checkMigrations(ctx context.Context) (string, error) {
+	expected, err := db.LatestVersion()
+	if err != nil {
+		return "", err
 	}
+
+	applied, dirty, err := app.models.Schema.MigrationVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case dirty:
+		return "", fmt.Errorf("migration %d is dirty", applied)
+	case applied < expected:
+		return "", fmt.Errorf("schema at version %d, expected %d", applied, expected)
+	}
+
+	return fmt.Sprintf("version %d", applied), nil
+}
+
+func (app *application) checkMailer(ctx context.Context) (string, error) {
+	addr := net.JoinHostPort(app.config.smtp.host, strconv.Itoa(app.config.smtp.port))
+
+	dialer := net.Dialer{Timeout: 2 * time.Second}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	return "", conn.Close()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,9 +10,11 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/kharljhon14/zentrix/internal/data"
 	"github.com/kharljhon14/zentrix/internal/validator"
 )
 
@@ -28,7 +31,13 @@ func (app application) writeJSON(
 		return err
 	}
 
-	maps.Insert(w.Header(), maps.All(headers))
+	// Add rather than replace, so that values middleware has already set,
+	// such as the successor-version Link on deprecated routes, are kept.
+	for key, values := range headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -116,6 +125,136 @@ func (app application) readInt(qs url.Values, key string, defaultValue int, v *v
 	return i
 }
 
+func (app application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number value")
+		return defaultValue
+	}
+
+	return f
+}
+
+func (app application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readPage reads paging parameters into f. Passing after or limit selects
+// keyset paging; otherwise the older page and page_size are used.
+func (app application) readPage(qs url.Values, f *data.Filters, v *validator.Validator) {
+	if !qs.Has("after") && !qs.Has("limit") {
+		f.Page = app.readInt(qs, "page", 1, v)
+		f.PageSize = app.readInt(qs, "page_size", 10, v)
+		return
+	}
+
+	v.Check(!qs.Has("page") && !qs.Has("page_size"), "page", "must not be combined with after or limit")
+
+	f.Keyset = true
+	f.Page = 1
+	f.PageSize = app.readInt(qs, "limit", 20, v)
+	f.After = qs.Get("after")
+	f.IncludeTotal = app.readBool(qs, "include_total", false, v)
+}
+
+// readConditions reads filters such as ?country=in:PH,SG for each field in
+// f.FilterSafeList. Where a field allows it, "me" stands for the
+// authenticated user's ID. Lists with a company field also read
+// ?include_subsidiaries=.
+func (app application) readConditions(r *http.Request, qs url.Values, f *data.Filters, v *validator.Validator) {
+	for _, name := range slices.Sorted(maps.Keys(f.FilterSafeList)) {
+		if f.FilterSafeList[name].Company {
+			f.IncludeSubsidiaries = app.readBool(qs, "include_subsidiaries", false, v)
+		}
+
+		for _, raw := range qs[name] {
+			condition := data.ParseCondition(name, raw)
+
+			if f.FilterSafeList[name].Me {
+				for i, value := range condition.Values {
+					if value != "me" {
+						continue
+					}
+
+					user := app.contextGetUser(r)
+					if user.IsAnonymous() {
+						v.AddError(name, "me requires an authenticated user")
+						continue
+					}
+					condition.Values[i] = user.ID.String()
+				}
+			}
+
+			f.Conditions = append(f.Conditions, condition)
+		}
+	}
+}
+
+// pageLinks returns RFC 8288 Link headers pointing at the neighbouring
+// pages of a list response, keeping the request's other query parameters.
+func (app application) pageLinks(r *http.Request, metadata data.Metadata) http.Header {
+	link := func(rel string, set map[string]string, del ...string) string {
+		u := url.URL{Path: r.URL.Path}
+		qs := r.URL.Query()
+		for _, key := range del {
+			qs.Del(key)
+		}
+		for key, value := range set {
+			qs.Set(key, value)
+		}
+		u.RawQuery = qs.Encode()
+
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	var links []string
+
+	if metadata.Limit > 0 {
+		links = append(links, link("first", nil, "after"))
+		if metadata.NextCursor != "" {
+			links = append(links, link("next", map[string]string{"after": metadata.NextCursor}))
+		}
+	} else if metadata.TotalRecords > 0 {
+		page := func(n int) map[string]string {
+			return map[string]string{"page": strconv.Itoa(n)}
+		}
+
+		links = append(links, link("first", page(metadata.FirstPage)))
+		if metadata.CurrentPage > metadata.FirstPage {
+			links = append(links, link("prev", page(metadata.CurrentPage-1)))
+		}
+		if metadata.CurrentPage < metadata.LastPage {
+			links = append(links, link("next", page(metadata.CurrentPage+1)))
+		}
+		links = append(links, link("last", page(metadata.LastPage)))
+	}
+
+	headers := make(http.Header)
+	if len(links) > 0 {
+		headers.Set("Link", strings.Join(links, ", "))
+	}
+
+	return headers
+}
+
 func (app application) isAllNil(input any) bool {
 	val := reflect.ValueOf(input)
 	for i := 0; i < val.NumField(); i++ {
@@ -126,3 +265,22 @@ func (app application) isAllNil(input any) bool {
 
 	return true
 }
+
+// background runs fn in a goroutine tracked by the application's WaitGroup
+// so graceful shutdown can wait for it to finish. fn's context is cancelled
+// when shutdown starts, and fn should return promptly once it is.
+func (app application) background(fn func(ctx context.Context)) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("background task panic: %v", err))
+			}
+		}()
+
+		fn(app.jobs)
+	}()
+}
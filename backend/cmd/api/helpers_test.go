@@ -0,0 +1,80 @@
+package main
+
+import (
+	"maps"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+func TestReadConditionsMe(t *testing.T) {
+	app := &application{}
+	user := &data.User{ID: uuid.New()}
+	other := uuid.NewString()
+
+	tests := []struct {
+		name   string
+		query  string
+		user   *data.User
+		want   []data.Condition
+		errors map[string]string
+	}{
+		{
+			name:   "me",
+			query:  "prepared_by=me",
+			user:   user,
+			want:   []data.Condition{{Field: "prepared_by", Op: data.OpEq, Values: []string{user.ID.String()}}},
+			errors: map[string]string{},
+		},
+		{
+			name:   "me in a list",
+			query:  "prepared_by=in:" + other + ",me",
+			user:   user,
+			want:   []data.Condition{{Field: "prepared_by", Op: data.OpIn, Values: []string{other, user.ID.String()}}},
+			errors: map[string]string{},
+		},
+		{
+			name:   "me with ne",
+			query:  "prepared_by=ne:me",
+			user:   user,
+			want:   []data.Condition{{Field: "prepared_by", Op: data.OpNe, Values: []string{user.ID.String()}}},
+			errors: map[string]string{},
+		},
+		{
+			name:   "me on a field without it",
+			query:  "prepared_for=me",
+			user:   user,
+			want:   []data.Condition{{Field: "prepared_for", Op: data.OpEq, Values: []string{"me"}}},
+			errors: map[string]string{},
+		},
+		{
+			name:   "me when anonymous",
+			query:  "prepared_by=me",
+			user:   data.AnonymousUser,
+			want:   []data.Condition{{Field: "prepared_by", Op: data.OpEq, Values: []string{"me"}}},
+			errors: map[string]string{"prepared_by": "me requires an authenticated user"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := app.contextSetUser(httptest.NewRequest("GET", "/v1/quotes?"+tt.query, nil), tt.user)
+
+			f := data.Filters{FilterSafeList: data.QuoteFilterFields}
+			v := validator.New()
+			app.readConditions(r, r.URL.Query(), &f, v)
+
+			if !reflect.DeepEqual(f.Conditions, tt.want) {
+				t.Errorf("got conditions %+v, want %+v", f.Conditions, tt.want)
+			}
+			if !maps.Equal(v.Errors, tt.errors) {
+				t.Errorf("got errors %v, want %v", v.Errors, tt.errors)
+			}
+		})
+	}
+}
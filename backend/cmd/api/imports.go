@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+	"github.com/kharljhon14/zentrix/internal/vcard"
+)
+
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 50_000
+
+	// Imports of up to syncImportRows rows are processed before responding;
+	// larger ones run in the background and are polled for progress.
+	syncImportRows = 500
+
+	// importProgressRows is how often a running import saves its progress.
+	importProgressRows = 250
+)
+
+// importer describes how the rows of a CSV import become records.
+type importer struct {
+	fields []string
+	// parse validates a row's values, keyed by field, and returns the
+	// record's email along with a function that upserts it.
+	parse func(values map[string]string, owner uuid.UUID, v *validator.Validator) (string, func(context.Context) (bool, error))
+	// existing returns which emails are already taken, for dry runs.
+	existing func(context.Context, []string) (map[string]bool, error)
+	// reference is the field blamed when an upsert fails with
+	// data.ErrInvalidUUID, and what it refers to.
+	reference, referenced string
+	created               prometheus.Counter
+	// vcard allows uploading vCard files as well as CSV.
+	vcard bool
+}
+
+func (app application) importers() map[string]importer {
+	return map[string]importer{
+		"companies": {
+			fields: []string{"name", "address", "email", "company_size", "industry", "business_type", "country", "image", "website", "sales_owner"},
+			parse: func(values map[string]string, owner uuid.UUID, v *validator.Validator) (string, func(context.Context) (bool, error)) {
+				company := &data.Company{
+					Name:         values["name"],
+					Address:      values["address"],
+					Email:        values["email"],
+					CompanySize:  values["company_size"],
+					Industry:     values["industry"],
+					BusinessType: values["business_type"],
+					Country:      values["country"],
+				}
+
+				if image := values["image"]; image != "" {
+					company.Image = &image
+				}
+				if website := values["website"]; website != "" {
+					company.Website = &website
+				}
+				if salesOwner := values["sales_owner"]; salesOwner != "" {
+					v.ValidateUUID(salesOwner, "sales_owner")
+					company.SalesOwner, _ = uuid.Parse(salesOwner)
+				}
+
+				data.ValidateCompany(v, company)
+
+				return company.Email, func(ctx context.Context) (bool, error) {
+					return app.models.Companies.Upsert(ctx, company, owner)
+				}
+			},
+			existing:   app.models.Companies.ExistingEmails,
+			reference:  "sales_owner",
+			referenced: "user",
+			created:    app.metrics.companiesCreated,
+		},
+		"contacts": {
+			fields: []string{"name", "email", "title", "status", "company_id"},
+			parse: func(values map[string]string, _ uuid.UUID, v *validator.Validator) (string, func(context.Context) (bool, error)) {
+				contact := &data.Contact{
+					Name:   values["name"],
+					Email:  values["email"],
+					Title:  values["title"],
+					Status: values["status"],
+				}
+
+				if companyID := values["company_id"]; companyID != "" {
+					v.ValidateUUID(companyID, "company_id")
+					if id, err := uuid.Parse(companyID); err == nil {
+						contact.CompanyID = &id
+					}
+				}
+
+				contact.ValidateContact(v)
+
+				return contact.Email, func(ctx context.Context) (bool, error) {
+					return app.models.Contacts.Upsert(ctx, contact)
+				}
+			},
+			existing:   app.models.Contacts.ExistingEmails,
+			reference:  "company_id",
+			referenced: "company",
+			created:    app.metrics.contactsCreated,
+			vcard:      true,
+		},
+	}
+}
+
+func (app application) importCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	app.importHandler(w, r, "companies")
+}
+
+func (app application) importContactsHandler(w http.ResponseWriter, r *http.Request) {
+	app.importHandler(w, r, "contacts")
+}
+
+// importHandler upserts records by email from an uploaded CSV file. The
+// multipart form holds the file, an optional JSON mapping of CSV columns to
+// fields (columns named after a field map to it by default) and dry_run,
+// which only validates. Contacts may also be uploaded as a vCard file, see
+// vcardRecords. Small files are imported before responding, larger ones in
+// the background.
+func (app application) importHandler(w http.ResponseWriter, r *http.Request, entity string) {
+	imp := app.importers()[entity]
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes+1_048_576)
+
+	err := r.ParseMultipartForm(maxImportBytes)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", maxImportBytes))
+		default:
+			app.badRequestResponse(w, r, errors.New("body must be a multipart form"))
+		}
+		return
+	}
+
+	v := validator.New()
+
+	dryRun := app.readBool(r.PostForm, "dry_run", false, v)
+
+	var mapping map[string]string
+	if raw := r.PostForm.Get("mapping"); raw != "" {
+		err := json.Unmarshal([]byte(raw), &mapping)
+		v.Check(err == nil, "mapping", "must be a JSON object of CSV columns to fields")
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		v.AddError("file", "must be provided")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	defer file.Close()
+
+	// Rows are numbered as in a spreadsheet, after the header, and cards
+	// from the start of a vCard file.
+	var header []string
+	var records [][]string
+	firstRow := 2
+
+	switch {
+	case isVCardFile(fileHeader) && imp.vcard:
+		var cards []vcard.Card
+		cards, err = vcard.Decode(file)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("file is not a valid vCard file: %w", err))
+			return
+		}
+
+		status := app.readString(r.PostForm, "status", "new")
+		header, records, err = app.vcardRecords(r.Context(), cards, status)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		firstRow = 1
+	case isVCardFile(fileHeader):
+		v.AddError("file", "must be a CSV file")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	default:
+		header, records, err = readCSV(file)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(len(records) > 0, "file", "must contain a header and at least one row")
+	v.Check(len(records) <= maxImportRows, "file", fmt.Sprintf("must not contain more than %d rows", maxImportRows))
+
+	columns := importColumns(header, mapping, imp.fields, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	job := &data.ImportJob{
+		OwnerID:   app.contextGetUser(r).ID,
+		Entity:    entity,
+		Status:    data.ImportPending,
+		DryRun:    dryRun,
+		TotalRows: len(records),
+	}
+
+	err = app.models.Imports.Insert(r.Context(), job)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%s", job.ID))
+
+	if len(records) > syncImportRows {
+		app.background(func(ctx context.Context) {
+			app.runImport(ctx, imp, job, columns, records, firstRow)
+		})
+
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"data": job}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.runImport(r.Context(), imp, job, columns, records, firstRow)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": job}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCSV reads a CSV file whose first record is the header. A leading
+// byte order mark, as written by Excel, is dropped.
+func readCSV(file io.Reader) ([]string, [][]string, error) {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("file must not be empty")
+		}
+		return nil, nil, fmt.Errorf("file is not valid CSV: %w", err)
+	}
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("file is not valid CSV: %w", err)
+	}
+
+	return header, records, nil
+}
+
+// importColumns returns the field each column of header maps to, keyed by
+// column index. Without a mapping, columns named after a field (ignoring
+// case, with spaces read as underscores) map to it.
+func importColumns(header []string, mapping map[string]string, fields []string, v *validator.Validator) map[int]string {
+	if mapping == nil {
+		mapping = make(map[string]string)
+		for _, column := range header {
+			field := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(column)), " ", "_")
+			if slices.Contains(fields, field) {
+				mapping[column] = field
+			}
+		}
+	}
+
+	columns := make(map[int]string, len(mapping))
+	mapped := make(map[string]string, len(mapping))
+
+	for column, field := range mapping {
+		i := slices.Index(header, column)
+		if i < 0 {
+			v.AddError("mapping."+column, "is not a column of the file")
+			continue
+		}
+
+		if !slices.Contains(fields, field) {
+			v.AddError("mapping."+column, fmt.Sprintf("must be one of: %s", strings.Join(fields, ", ")))
+			continue
+		}
+
+		if other, ok := mapped[field]; ok {
+			v.AddError("mapping."+column, fmt.Sprintf("maps to %s, as does %s", field, other))
+			continue
+		}
+
+		columns[i] = field
+		mapped[field] = column
+	}
+
+	_, ok := mapped["email"]
+	v.Check(ok || !v.Valid(), "mapping", "must map a column to email")
+
+	return columns
+}
+
+// runImport validates every row and, unless job is a dry run, upserts the
+// valid ones, saving progress to job as it goes. Errors number the rows
+// from firstRow.
+func (app application) runImport(ctx context.Context, imp importer, job *data.ImportJob, columns map[int]string, records [][]string, firstRow int) {
+	fail := func(err error) {
+		app.logger.Error("import failed", "import_id", job.ID, "error", err)
+
+		now := time.Now()
+		job.Status = data.ImportFailed
+		job.FinishedAt = &now
+
+		err = app.models.Imports.Update(context.Background(), job)
+		if err != nil {
+			app.logger.Error("failed to save import", "import_id", job.ID, "error", err)
+		}
+	}
+
+	rowErrors := func(row int, errs map[string]string) {
+		for _, field := range slices.Sorted(maps.Keys(errs)) {
+			job.Errors = append(job.Errors, data.ImportError{Row: row, Field: field, Message: errs[field]})
+		}
+		job.FailedRows++
+		job.ProcessedRows++
+	}
+
+	job.Status = data.ImportRunning
+	err := app.models.Imports.Update(ctx, job)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	type row struct {
+		number int
+		email  string
+		save   func(context.Context) (bool, error)
+	}
+
+	var rows []row
+	seen := make(map[string]int, len(records))
+
+	for i, record := range records {
+		number := i + firstRow
+
+		values := make(map[string]string, len(columns))
+		for column, field := range columns {
+			values[field] = strings.TrimSpace(record[column])
+		}
+
+		// Rows are matched to each other and to existing records by email,
+		// so "Jane@Acme.test" and "jane@acme.test" are the same record.
+		values["email"] = strings.ToLower(values["email"])
+
+		v := validator.New()
+
+		email, save := imp.parse(values, job.OwnerID, v)
+		if first, ok := seen[email]; ok && email != "" {
+			v.AddError("email", fmt.Sprintf("duplicates row %d", first))
+		}
+
+		if !v.Valid() {
+			rowErrors(number, v.Errors)
+			continue
+		}
+
+		seen[email] = number
+		rows = append(rows, row{number: number, email: email, save: save})
+	}
+
+	if job.DryRun {
+		emails := make([]string, len(rows))
+		for i, row := range rows {
+			emails[i] = row.email
+		}
+
+		existing, err := imp.existing(ctx, emails)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for _, row := range rows {
+			if existing[row.email] {
+				job.UpdatedRows++
+			} else {
+				job.CreatedRows++
+			}
+			job.ProcessedRows++
+		}
+	} else {
+		for i, row := range rows {
+			created, err := row.save(ctx)
+			switch {
+			case errors.Is(err, data.ErrInvalidUUID):
+				rowErrors(row.number, map[string]string{imp.reference: imp.referenced + " not found"})
+				continue
+			case err != nil:
+				fail(err)
+				return
+			case created:
+				job.CreatedRows++
+				imp.created.Inc()
+			default:
+				job.UpdatedRows++
+			}
+			job.ProcessedRows++
+
+			if (i+1)%importProgressRows == 0 {
+				err := app.models.Imports.Update(ctx, job)
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}
+	}
+
+	// Rows were validated in order but saved afterwards, so the errors of
+	// rows that failed to save are out of place.
+	slices.SortStableFunc(job.Errors, func(a, b data.ImportError) int {
+		return a.Row - b.Row
+	})
+
+	now := time.Now()
+	job.Status = data.ImportCompleted
+	job.FinishedAt = &now
+
+	err = app.models.Imports.Update(ctx, job)
+	if err != nil {
+		fail(err)
+	}
+}
+
+// readImport loads the import named by the id URL parameter, writing the
+// error response and returning nil if it is invalid or not the user's.
+func (app application) readImport(w http.ResponseWriter, r *http.Request) *data.ImportJob {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	job, err := app.models.Imports.GetByID(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "import")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if !job.VisibleTo(app.contextGetUser(r)) {
+		app.notFoundResponse(w, r, "import")
+		return nil
+	}
+
+	return job
+}
+
+func (app application) getImportHandler(w http.ResponseWriter, r *http.Request) {
+	job := app.readImport(w, r)
+	if job == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"data": job}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getImportErrorsHandler downloads an import's row errors as CSV.
+func (app application) getImportErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	job := app.readImport(w, r)
+	if job == nil {
+		return
+	}
+
+	errs, err := app.models.Imports.GetErrors(r.Context(), job.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, job.ID))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"row", "field", "message"})
+	for _, e := range errs {
+		cw.Write([]string{strconv.Itoa(e.Row), e.Field, e.Message})
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newLogger returns a JSON logger whose records are enriched with request
+// correlation fields whenever they are logged with a request context.
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(contextHandler{Handler: h})
+}
+
+// contextHandler adds the chi request ID, the trace and span IDs, the
+// authenticated user ID, the matched route pattern and the latency so far
+// to every record logged through one of the *Context logger methods.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if reqID := middleware.GetReqID(ctx); reqID != "" {
+		record.AddAttrs(slog.String("request_id", reqID))
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			record.AddAttrs(slog.String("route", pattern))
+		}
+	}
+
+	if info := contextGetRequestInfo(ctx); info != nil {
+		if info.userID != "" {
+			record.AddAttrs(slog.String("user_id", info.userID))
+		}
+		record.AddAttrs(slog.Duration("latency", time.Since(info.start)))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
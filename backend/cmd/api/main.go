@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
-	"log"
+	"log/slog"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kharljhon14/zentrix/internal/data"
@@ -15,42 +18,175 @@ import (
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port     int
+	env      string
+	logLevel slog.Level
+	db       struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
+	limiter struct {
+		enabled  bool
+		requests int
+		window   time.Duration
+	}
+	cors struct {
+		trustedOrigins stringList
+	}
+	admin struct {
+		email string
+	}
+	timeouts struct {
+		read     time.Duration
+		write    time.Duration
+		idle     time.Duration
+		handler  time.Duration
+		shutdown time.Duration
+		drain    time.Duration
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	metrics struct {
+		enabled bool
+		addr    string
+		token   string
+	}
+	tracing struct {
+		exporter     string
+		otlpEndpoint string
+		otlpInsecure bool
+		sampleRatio  float64
+	}
+	tokens struct {
+		activationTTL     time.Duration
+		authenticationTTL time.Duration
+	}
+	api struct {
+		legacyRoutes bool
+		legacySunset time.Time
+	}
+	trash struct {
+		retentionDays int
+		purgeInterval time.Duration
+	}
 }
 
 type application struct {
-	config config
-	models data.Models
+	config  config
+	models  data.Models
+	logger  *slog.Logger
+	metrics *metrics
+	wg      *sync.WaitGroup
+
+	// jobs is the context of background tasks. stopJobs cancels it when
+	// shutdown starts.
+	jobs     context.Context
+	stopJobs context.CancelFunc
+
+	// shuttingDown flips to true when a shutdown signal arrives so that
+	// /readyz starts failing while in-flight requests drain.
+	shuttingDown *atomic.Bool
 }
 
 func main() {
-	var cfg config
+	os.Exit(run())
+}
+
+// run starts the application and returns the process exit code, so that
+// deferred cleanup such as flushing traces happens before main exits.
+func run() int {
+	cfg, fs, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		newLogger(os.Stderr, slog.LevelInfo).Error("failed to load config", "error", err)
+		return 1
+	}
+
+	logger := newLogger(os.Stdout, cfg.logLevel)
 
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment(development|production|statging)")
-	flag.StringVar(&cfg.db.dsn, "dsn", os.Getenv("DSN"), "PostgreSQL DSN")
+	logger.Info("effective configuration", effectiveConfig(fs)...)
 
-	flag.Parse()
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
 
 	db, err := openDB(cfg)
 	if err != nil {
-		log.Printf("Failed to connect to DB %v", err)
-		os.Exit(1)
+		logger.Error("failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	logger.Info("database connection pool established")
+
+	models := data.NewModels(db)
+
+	if cfg.admin.email != "" {
+		err = promoteAdmin(models, cfg.admin.email)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			logger.Warn("admin user not found; register it and restart to make it an admin", "email", cfg.admin.email)
+		case err != nil:
+			logger.Error("failed to promote admin user", "error", err)
+			return 1
+		default:
+			logger.Info("admin user promoted", "email", cfg.admin.email)
+		}
 	}
 
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
 	app := &application{
-		config: cfg,
-		models: data.NewModels(db),
+		config:  cfg,
+		models:  models,
+		logger:  logger,
+		metrics: newMetrics(db),
+		wg:      &sync.WaitGroup{},
+
+		jobs:     jobs,
+		stopJobs: stopJobs,
+
+		shuttingDown: &atomic.Bool{},
 	}
 
-	app.serve()
+	err = app.serve()
+	if err != nil {
+		logger.Error("server error", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// promoteAdmin gives the user with email the admin role, so that the first
+// admin of an install is chosen by its operator rather than by whoever
+// registers first.
+func promoteAdmin(models data.Models, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return models.Users.Promote(ctx, email)
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -60,7 +196,7 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 
 	db.SetMaxIdleConns(cfg.db.maxIdleConns)
-	db.SetConnMaxLifetime(cfg.db.maxIdleTime)
+	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
 	db.SetMaxOpenConns(cfg.db.maxOpenConns)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "zentrix"
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	requestsTotal    *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	rateLimited      prometheus.Counter
+
+	deprecatedRequests *prometheus.CounterVec
+
+	companiesCreated prometheus.Counter
+	companiesDeleted prometheus.Counter
+	contactsCreated  prometheus.Counter
+	contactsDeleted  prometheus.Counter
+	quotesCreated    prometheus.Counter
+	quotesDeleted    prometheus.Counter
+	usersRegistered  prometheus.Counter
+}
+
+func newMetrics(db *sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Total HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_rate_limited_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+
+		deprecatedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_deprecated_requests_total",
+			Help:      "Requests served by deprecated routes, by method and route pattern.",
+		}, []string{"method", "route"}),
+
+		companiesCreated: newBusinessCounter("companies_created_total", "Companies created."),
+		companiesDeleted: newBusinessCounter("companies_deleted_total", "Companies deleted."),
+		contactsCreated:  newBusinessCounter("contacts_created_total", "Contacts created."),
+		contactsDeleted:  newBusinessCounter("contacts_deleted_total", "Contacts deleted."),
+		quotesCreated:    newBusinessCounter("quotes_created_total", "Quotes created."),
+		quotesDeleted:    newBusinessCounter("quotes_deleted_total", "Quotes deleted."),
+		usersRegistered:  newBusinessCounter("users_registered_total", "Users registered."),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "postgres"),
+		m.requestsTotal,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.rateLimited,
+		m.deprecatedRequests,
+		m.companiesCreated,
+		m.companiesDeleted,
+		m.contactsCreated,
+		m.contactsDeleted,
+		m.quotesCreated,
+		m.quotesDeleted,
+		m.usersRegistered,
+	)
+
+	return m
+}
+
+func newBusinessCounter(name, help string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      name,
+		Help:      help,
+	})
+}
+
+func (app *application) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(app.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// instrument records request counts and latencies keyed by the chi route
+// pattern rather than the raw path, so IDs don't explode label cardinality.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.metrics.requestsInFlight.Inc()
+		defer app.metrics.requestsInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		app.metrics.requestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		app.metrics.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// requireMetricsToken rejects scrapes that don't present the configured
+// bearer token. It is a no-op when no token is configured.
+func (app *application) requireMetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.metrics.token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := []byte("Bearer " + app.config.metrics.token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsRoutes is served on its own listener when metrics-addr is set.
+func (app *application) metricsRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(app.recoverPanic)
+	r.With(app.requireMetricsToken).Get("/metrics", app.metricsHandler().ServeHTTP)
+
+	return r
+}
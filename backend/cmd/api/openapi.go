@@ -0,0 +1,92 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The spec is maintained as YAML for readability and served as JSON.
+// openapi_test.go fails if it drifts from the router.
+//
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+var openAPIJSON = mustOpenAPIJSON(openAPIYAML)
+
+func mustOpenAPIJSON(src []byte) []byte {
+	var spec map[string]any
+	err := yaml.Unmarshal(src, &spec)
+	if err != nil {
+		panic(fmt.Sprintf("openapi.yaml: %v", err))
+	}
+
+	spec["info"].(map[string]any)["version"] = version
+
+	js, err := json.Marshal(spec)
+	if err != nil {
+		panic(fmt.Sprintf("openapi.yaml: %v", err))
+	}
+
+	return js
+}
+
+// docsAssets holds the Redoc standalone bundle, fetched into docs/ with
+// make redoc so the reference page doesn't depend on a CDN.
+//
+//go:embed docs
+var docsAssets embed.FS
+
+const (
+	redocPath = "/docs/redoc.standalone.js"
+	redocCDN  = "https://cdn.redoc.ly/redoc/v2.5.0/bundles/redoc.standalone.js"
+)
+
+// redocBundle is nil in builds made without the bundle, whose docs page
+// loads it from redocCDN instead.
+var redocBundle, _ = docsAssets.ReadFile("docs/redoc.standalone.js")
+
+var docsPage = fmt.Sprintf(`<!doctype html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Zentrix API</title>
+</head>
+<body>
+	<redoc spec-url="/openapi.json"></redoc>
+	<script src="%s"></script>
+</body>
+</html>
+`, redocSrc())
+
+func redocSrc() string {
+	if redocBundle == nil {
+		return redocCDN
+	}
+	return redocPath
+}
+
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+func (app *application) redocHandler(w http.ResponseWriter, r *http.Request) {
+	if redocBundle == nil {
+		app.routeNotFoundResponse(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(redocBundle)
+}
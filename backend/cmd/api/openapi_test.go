@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var cfg config
+	cfg.limiter.enabled = true
+	cfg.limiter.requests = 1
+	cfg.limiter.window = time.Second
+	cfg.metrics.enabled = true
+	cfg.timeouts.handler = time.Second
+	cfg.api.legacyRoutes = true
+
+	app := &application{config: cfg, metrics: newMetrics(db)}
+
+	var routed []string
+	err = chi.Walk(app.routes().(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed = append(routed, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err = json.Unmarshal(openAPIJSON, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var documented []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	for _, route := range routed {
+		// Unversioned routes are deprecated aliases of /v1 and are only
+		// described in the spec's introduction.
+		method, path, _ := strings.Cut(route, " ")
+		if !strings.HasPrefix(path, "/v1/") && slices.Contains(routed, method+" /v1"+path) {
+			continue
+		}
+
+		if !slices.Contains(documented, route) {
+			t.Errorf("%s is routed but missing from openapi.yaml", route)
+		}
+	}
+	for _, op := range documented {
+		if !slices.Contains(routed, op) {
+			t.Errorf("%s is in openapi.yaml but not routed", op)
+		}
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	var spec map[string]any
+	err := json.Unmarshal(openAPIJSON, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walk func(node any)
+	walk = func(node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			if ref, ok := node["$ref"].(string); ok && !resolves(spec, ref) {
+				t.Errorf("unresolved $ref %q", ref)
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case []any:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
+
+func resolves(spec map[string]any, ref string) bool {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+
+	var node any = spec
+	for part := range strings.SplitSeq(pointer, "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = m[part]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
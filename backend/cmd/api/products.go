@@ -3,7 +3,6 @@ package main
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -18,17 +17,17 @@ func (app application) getProductsByQuoteIDHandler(w http.ResponseWriter, r *htt
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	products, err := app.models.Products.GetProductsByQuoteID(uuid.MustParse(IDParam))
+	products, err := app.models.Products.GetProductsByQuoteID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "no products found with given quote ID")
+			app.notFoundResponse(w, r, "quote")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -53,11 +52,11 @@ func (app application) updateProductHandler(w http.ResponseWriter, r *http.Reque
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 	if app.isAllNil(input) {
-		app.badRequestResponse(w, errors.New("body must not be empty"))
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
 		return
 	}
 
@@ -65,18 +64,17 @@ func (app application) updateProductHandler(w http.ResponseWriter, r *http.Reque
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	product, err := app.models.Products.GetProductByID(uuid.MustParse(IDParam))
+	product, err := app.models.Products.GetProductByID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
-		fmt.Println(err)
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "product not found")
+			app.notFoundResponse(w, r, "product")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -95,24 +93,24 @@ func (app application) updateProductHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if product.ValidateProduct(v); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	product, err = app.models.Products.Update(product)
+	product, err = app.models.Products.Update(r.Context(), product)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "product not found")
+			app.notFoundResponse(w, r, "product")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": product}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 
 }
@@ -125,17 +123,17 @@ func (app application) deleteProductHandler(w http.ResponseWriter, r *http.Reque
 	v.ValidateUUID(IDParam, "id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err := app.models.Products.Delete(uuid.MustParse(IDParam))
+	err := app.models.Products.Delete(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "product not found")
+			app.notFoundResponse(w, r, "product")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 	}
 
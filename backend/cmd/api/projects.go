@@ -1,8 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/kharljhon14/zentrix/internal/data"
 	"github.com/kharljhon14/zentrix/internal/validator"
@@ -19,7 +22,7 @@ func (app application) createProjectHandler(w http.ResponseWriter, r *http.Reque
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -29,7 +32,7 @@ func (app application) createProjectHandler(w http.ResponseWriter, r *http.Reque
 	v.ValidateUUID(input.OwnerID, "owner_id")
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
@@ -43,9 +46,54 @@ func (app application) createProjectHandler(w http.ResponseWriter, r *http.Reque
 
 	project.Validate(v)
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	app.models.Projects.Insert(&project)
+	app.models.Projects.Insert(r.Context(), &project)
+}
+
+// deleteProjectHandler moves a project to the trash. Users other than
+// admins can only delete projects they own.
+func (app application) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+	v.ValidateUUID(IDParam, "id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	project, err := app.models.Projects.GetByID(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "project")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user := app.contextGetUser(r); user.Role != data.RoleAdmin && project.OwnerID != user.ID {
+		app.notFoundResponse(w, r, "project")
+		return
+	}
+
+	err = app.models.Projects.Delete(r.Context(), project.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "project")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "project deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -16,30 +17,30 @@ import (
 func (app application) createQuoteHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name        string `json:"name"`
-		CompanyID   string `json:"company_id"`
+		CompanyID   string `json:"company_id" validate:"required,uuid"`
 		SalesTax    int    `json:"sales_tax"`
 		Stage       string `json:"stage"`
 		Notes       string `json:"notes"`
-		PreparedBy  string `json:"prepared_by"`
-		PreparedFor string `json:"prepared_for"`
+		PreparedBy  string `json:"prepared_by" validate:"required,uuid"`
+		PreparedFor string `json:"prepared_for" validate:"required,uuid"`
 		Products    []struct {
 			Title     string `json:"title"`
 			UnitPrice int    `json:"unit_price"`
 			Quantity  int    `json:"quantity"`
 			Discount  int    `json:"discount"`
 		} `json:"products"`
+		// CustomFields maps custom field keys to values.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	v := validator.New()
-	v.ValidateUUID(input.CompanyID, "company_id")
-	v.ValidateUUID(input.PreparedBy, "prepared_by")
-	v.ValidateUUID(input.PreparedFor, "prepared_for")
+	v.Struct(input)
 
 	quote := data.Quote{
 		Name:     input.Name,
@@ -49,38 +50,67 @@ func (app application) createQuoteHandler(w http.ResponseWriter, r *http.Request
 	}
 	quote.ValidateQuote(v)
 
+	quote.CustomFields = data.CustomFields{}
+	quote.CustomFields.Apply(input.CustomFields)
+
+	err = app.validateCustomFields(r.Context(), "quotes", quote.CustomFields, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var products []data.Product
+	for _, productInput := range input.Products {
+		product := data.Product{
+			Title:     productInput.Title,
+			UnitPrice: productInput.UnitPrice,
+			Quantity:  productInput.Quantity,
+			Discount:  productInput.Discount,
+		}
+		products = append(products, product)
+	}
+
+	// Validate every product up front so a bad line item doesn't leave a
+	// half-created quote behind. Errors are keyed like products[2].unit_price.
+	v.Value("products", products)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	companyID := uuid.MustParse(input.CompanyID)
-	_, err = app.models.Companies.GetByID(companyID)
+	_, err = app.models.Companies.GetByID(r.Context(), companyID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "company not found")
+			app.notFoundResponse(w, r, "company")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
 	preparedBy := uuid.MustParse(input.PreparedBy)
-	_, err = app.models.Users.GetByID(preparedBy)
+	_, err = app.models.Users.GetByID(r.Context(), preparedBy)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "prepared By ID not found")
+			app.notFoundResponse(w, r, "prepared_by")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
 	prepareFor := uuid.MustParse(input.PreparedFor)
-	_, err = app.models.Contacts.GetByID(prepareFor)
+	_, err = app.models.Contacts.GetByID(r.Context(), prepareFor)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "prepared for ID not found")
+			app.notFoundResponse(w, r, "prepared_for")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -89,54 +119,31 @@ func (app application) createQuoteHandler(w http.ResponseWriter, r *http.Request
 	quote.PreparedBy = preparedBy
 	quote.PreparedFor = prepareFor
 
-	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
-		return
-	}
-
-	err = app.models.Quotes.Insert(&quote)
+	err = app.models.Quotes.Insert(r.Context(), &quote)
 	if err != nil {
-
-		fmt.Println(err)
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	var products []data.Product
-	for _, productInput := range input.Products {
-		product := data.Product{
-			QuoteID:   quote.ID,
-			Title:     productInput.Title,
-			UnitPrice: productInput.UnitPrice,
-			Quantity:  productInput.Quantity,
-			Discount:  productInput.Discount,
-		}
-		products = append(products, product)
-	}
-
 	for i, product := range products {
-		product.ValidateProduct(v)
+		product.QuoteID = quote.ID
 
-		if !v.Valid() {
-			app.failedValidationResponse(w, v.Errors)
-			//TODO Remove the inserted Quote
-			return
-		}
-
-		err := app.models.Products.Insert(&product)
+		err := app.models.Products.Insert(r.Context(), &product)
 		if err != nil {
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 			return
 		}
 		products[i] = product
 	}
 
+	app.metrics.quotesCreated.Inc()
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{
 		"quote":    quote,
 		"products": products,
 	}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
@@ -146,25 +153,24 @@ func (app application) getQuoteByIDHandler(w http.ResponseWriter, r *http.Reques
 	v := validator.New()
 	v.Check(IDParam != "", "id", "id is required")
 	if v.ValidateUUID(IDParam, "id"); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	quote, err := app.models.Quotes.GetByID(uuid.MustParse(IDParam))
+	quote, err := app.models.Quotes.GetByID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "quote not found")
+			app.notFoundResponse(w, r, "quote")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	products, err := app.models.Products.GetProductsByQuoteID(quote.ID)
+	products, err := app.models.Products.GetProductsByQuoteID(r.Context(), quote.ID)
 	if err != nil {
-		fmt.Println(err)
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
@@ -176,17 +182,60 @@ func (app application) getQuoteByIDHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (app application) listQuotesHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		data.Filters
+	qs, ok := app.listQuery(w, r, "quotes")
+	if !ok {
+		return
+	}
+
+	fields, err := app.models.CustomFields.GetAll(r.Context(), "quotes")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	qs := r.URL.Query()
+	filters := app.quoteListFilters(r, qs, fields, v)
+	columns := readColumns(qs, quoteExportColumns, v)
+	download := readExport(r, qs, columns, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if download != nil {
+		exportRows(app, w, r, "quotes", download, func(ctx context.Context, fn func(*data.QuoteWithRelationNames) error) error {
+			return app.models.Quotes.Export(ctx, filters, fn)
+		})
+		return
+	}
+
+	quotes, metadata, err := app.models.Quotes.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := pickColumns(quotes, qs, columns)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": records, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// quoteListFilters reads the list parameters of GET /quotes, including
+// filters and sorts on the entity's custom fields.
+func (app application) quoteListFilters(r *http.Request, qs url.Values, fields []*data.CustomField, v *validator.Validator) data.Filters {
+	var filters data.Filters
 
-	input.Page = app.readInt(qs, "page", 1, v)
-	input.PageSize = app.readInt(qs, "page_size", 10, v)
-	input.Sort = app.readString(qs, "sort", "-created_at")
-	input.SortSafeList = []string{
+	app.readPage(qs, &filters, v)
+	filters.Sort = app.readString(qs, "sort", "-created_at")
+	filters.SortSafeList = []string{
 		"id",
 		"company_id",
 		"name",
@@ -205,22 +254,11 @@ func (app application) listQuotesHandler(w http.ResponseWriter, r *http.Request)
 		"-updated_at",
 	}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
-		return
-	}
-
-	quotes, metadata, err := app.models.Quotes.GetAll(input.Filters)
-	if err != nil {
-		fmt.Println(err)
-		app.serverErrorResponse(w, err)
-		return
-	}
+	filters.FilterSafeList = data.QuoteFilterFields
+	filters.AddCustomFields("q", fields)
+	app.readConditions(r, qs, &filters, v)
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"data": quotes, "metadata": metadata}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, err)
-	}
+	return filters
 }
 
 func (app application) updateQuoteHandler(w http.ResponseWriter, r *http.Request) {
@@ -228,49 +266,42 @@ func (app application) updateQuoteHandler(w http.ResponseWriter, r *http.Request
 
 	var input struct {
 		Name        *string `json:"name"`
-		CompanyID   *string `json:"company_id"`
+		CompanyID   *string `json:"company_id" validate:"uuid"`
 		Stage       *string `json:"stage"`
 		Notes       *string `json:"notes"`
-		PreparedBy  *string `json:"prepared_by"`
-		PreparedFor *string `json:"prepared_for"`
+		PreparedBy  *string `json:"prepared_by" validate:"uuid"`
+		PreparedFor *string `json:"prepared_for" validate:"uuid"`
+		// CustomFields sets the custom fields given; null clears one.
+		CustomFields map[string]any `json:"custom_fields"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	if app.isAllNil(input) {
-		app.badRequestResponse(w, errors.New("body must not be empty"))
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
 		return
 	}
 
 	v := validator.New()
 	v.ValidateUUID(IDParam, "id")
-	if input.CompanyID != nil {
-		v.ValidateUUID(*input.CompanyID, "company_id")
-	}
-	if input.PreparedBy != nil {
-		v.ValidateUUID(*input.PreparedBy, "prepared_by")
-	}
-	if input.PreparedFor != nil {
-		v.ValidateUUID(*input.PreparedFor, "prepared_for")
-	}
+	v.Struct(input)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	quote, err := app.models.Quotes.GetByID(uuid.MustParse(IDParam))
+	quote, err := app.models.Quotes.GetByID(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
-		fmt.Println(err)
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "quote not found")
+			app.notFoundResponse(w, r, "quote")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -282,13 +313,13 @@ func (app application) updateQuoteHandler(w http.ResponseWriter, r *http.Request
 
 		quote.CompanyID = uuid.MustParse(*input.CompanyID)
 
-		_, err = app.models.Companies.GetByID(quote.CompanyID)
+		_, err = app.models.Companies.GetByID(r.Context(), quote.CompanyID)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
-				app.notFoundResponse(w, "company not found")
+				app.notFoundResponse(w, r, "company")
 			default:
-				app.serverErrorResponse(w, err)
+				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
@@ -302,13 +333,13 @@ func (app application) updateQuoteHandler(w http.ResponseWriter, r *http.Request
 	if input.PreparedBy != nil {
 		quote.PreparedBy = uuid.MustParse(*input.PreparedBy)
 
-		_, err = app.models.Users.GetByID(quote.PreparedBy)
+		_, err = app.models.Users.GetByID(r.Context(), quote.PreparedBy)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
-				app.notFoundResponse(w, "user not found")
+				app.notFoundResponse(w, r, "user")
 			default:
-				app.serverErrorResponse(w, err)
+				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
@@ -316,34 +347,43 @@ func (app application) updateQuoteHandler(w http.ResponseWriter, r *http.Request
 	if input.PreparedFor != nil {
 		quote.PreparedFor = uuid.MustParse(*input.PreparedFor)
 
-		_, err = app.models.Contacts.GetByID(quote.PreparedFor)
+		_, err = app.models.Contacts.GetByID(r.Context(), quote.PreparedFor)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
-				app.notFoundResponse(w, "contact not found")
+				app.notFoundResponse(w, r, "contact")
 			default:
-				app.serverErrorResponse(w, err)
+				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
 	}
 
+	if input.CustomFields != nil {
+		quote.CustomFields.Apply(input.CustomFields)
+
+		err = app.validateCustomFields(r.Context(), "quotes", quote.CustomFields, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	quote.ValidateQuote(v)
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Quotes.Update(quote)
+	err = app.models.Quotes.Update(r.Context(), quote)
 	if err != nil {
-		fmt.Println(err)
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": quote}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
@@ -353,23 +393,25 @@ func (app application) deleteQuoteHandler(w http.ResponseWriter, r *http.Request
 	v := validator.New()
 	v.ValidateUUID(IDParam, "id")
 	if !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err := app.models.Quotes.Delete(uuid.MustParse(IDParam))
+	err := app.models.Quotes.Delete(r.Context(), uuid.MustParse(IDParam))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			app.notFoundResponse(w, "quote not found")
+			app.notFoundResponse(w, r, "quote")
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	app.metrics.quotesDeleted.Inc()
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "quote deleted successfully"}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,56 +11,145 @@ import (
 
 func (app *application) routes() http.Handler {
 	r := chi.NewRouter()
+	r.NotFound(app.routeNotFoundResponse)
+	r.MethodNotAllowed(app.methodNotAllowedResponse)
+
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(app.traceRequests)
+	r.Use(app.logRequests)
+	r.Use(app.instrument)
+	r.Use(app.recoverPanic)
+	r.Use(middleware.Timeout(app.config.timeouts.handler))
 
 	r.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"http://localhost:5173", "http://127.0.0.1:5173"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		AllowedOrigins:   app.config.cors.trustedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", apiVersionHeader},
+		ExposedHeaders:   []string{"Link", "Deprecation", "Sunset", apiVersionHeader},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
-	r.Use(httprate.LimitByIP(100, time.Minute))
+	// Probes, docs and metrics sit outside the rate limiter and authenticate so
+	// frequent scrapes aren't throttled and the scrape token isn't mistaken
+	// for a user token.
+	r.Get("/livez", app.livezHandler)
+	r.Get("/readyz", app.readyzHandler)
+	r.Get("/openapi.json", app.openAPIHandler)
+	r.Get("/docs", app.docsHandler)
+	r.Get(redocPath, app.redocHandler)
+
+	if app.config.metrics.enabled && app.config.metrics.addr == "" {
+		r.With(app.requireMetricsToken).Get("/metrics", app.metricsHandler().ServeHTTP)
+	}
+
+	r.Group(func(r chi.Router) {
+		if app.config.limiter.enabled {
+			r.Use(httprate.Limit(
+				app.config.limiter.requests,
+				app.config.limiter.window,
+				httprate.WithKeyByIP(),
+				httprate.WithLimitHandler(app.rateLimitExceededResponse),
+			))
+		}
+
+		r.Use(app.authenticate)
+
+		r.Route("/v1", func(r chi.Router) {
+			r.Use(app.negotiateVersion("v1"))
+			app.apiRoutes(r)
+		})
+
+		if app.config.api.legacyRoutes {
+			r.Group(app.legacyRoutes)
+		}
+	})
+
+	return r
+}
 
+func (app *application) apiRoutes(r chi.Router) {
 	r.Get("/healthcheck", app.healthCheckHandler)
 
+	r.Get("/search", app.requireActivatedUser(app.searchHandler))
+
 	// User auth
 	r.Post("/register", app.registerUserHandler)
 	r.Put("/activate", app.activateUserHandler)
+	r.Post("/tokens/authentication", app.createAuthenticationTokenHandler)
 
 	// Companies
 	r.Post("/companies", app.createCompanyHandler)
 	r.Get("/companies", app.listCompaniesHandler)
+	r.Post("/companies/import", app.requireActivatedUser(app.importCompaniesHandler))
+	r.Get("/companies/duplicates", app.requireActivatedUser(app.listDuplicatesHandler))
+	r.Post("/companies/duplicates/detect", app.requireActivatedUser(app.detectDuplicatesHandler))
+	r.Post("/companies/tags", app.requireActivatedUser(app.tagCompaniesHandler))
 	r.Get("/companies/{id}", app.getCompanyByIDHandler)
+	r.Get("/companies/{id}/tree", app.getCompanyTreeHandler)
 	r.Patch("/companies/{id}", app.updatedCompanyHandler)
 	r.Delete("/companies/{id}", app.deleteCompanyHandler)
+	r.Post("/companies/{id}/merge", app.requireActivatedUser(app.mergeCompanyHandler))
+	r.Post("/companies/{id}/restore", app.requireActivatedUser(app.restoreCompanyHandler))
 
 	// Contacts
 	r.Post("/contacts", app.createContactHandler)
 	r.Get("/contacts", app.listContactsHandler)
+	r.Post("/contacts/import", app.requireActivatedUser(app.importContactsHandler))
+	r.Post("/contacts/tags", app.requireActivatedUser(app.tagContactsHandler))
 	r.Get("/contacts/{id}", app.getContactByIDHandler)
+	r.Get("/contacts/{id}.vcf", app.getContactVCardHandler)
 	r.Patch("/contacts/{id}", app.updateContactHandler)
 	r.Delete("/contacts/{id}", app.deleteContactHandler)
+	r.Post("/contacts/{id}/merge", app.requireActivatedUser(app.mergeContactHandler))
+	r.Post("/contacts/{id}/restore", app.requireActivatedUser(app.restoreContactHandler))
 
 	// Quotes
 	r.Post("/quotes", app.createQuoteHandler)
+	r.Post("/quotes/tags", app.requireActivatedUser(app.tagQuotesHandler))
 	r.Get("/quotes/{id}", app.getQuoteByIDHandler)
 	r.Get("/quotes", app.listQuotesHandler)
 	r.Patch("/quotes/{id}", app.updateQuoteHandler)
 	r.Delete("/quotes/{id}", app.deleteQuoteHandler)
+	r.Post("/quotes/{id}/restore", app.requireActivatedUser(app.restoreQuoteHandler))
+
+	// Projects
+	r.Post("/projects/tags", app.requireActivatedUser(app.tagProjectsHandler))
+	r.Delete("/projects/{id}", app.requireActivatedUser(app.deleteProjectHandler))
+	r.Post("/projects/{id}/restore", app.requireActivatedUser(app.restoreProjectHandler))
+
+	// Trash
+	r.Get("/trash", app.requireActivatedUser(app.listTrashHandler))
+
+	// Imports
+	r.Get("/imports/{id}", app.requireActivatedUser(app.getImportHandler))
+	r.Get("/imports/{id}/errors", app.requireActivatedUser(app.getImportErrorsHandler))
+
+	// Saved views
+	r.Post("/views", app.requireActivatedUser(app.createViewHandler))
+	r.Get("/views", app.requireActivatedUser(app.listViewsHandler))
+	r.Get("/views/{id}", app.requireActivatedUser(app.getViewHandler))
+	r.Patch("/views/{id}", app.requireActivatedUser(app.updateViewHandler))
+	r.Delete("/views/{id}", app.requireActivatedUser(app.deleteViewHandler))
+
+	// Tags
+	r.Post("/tags", app.requireActivatedUser(app.createTagHandler))
+	r.Get("/tags", app.requireActivatedUser(app.listTagsHandler))
+	r.Get("/tags/{id}", app.requireActivatedUser(app.getTagHandler))
+	r.Patch("/tags/{id}", app.requireActivatedUser(app.updateTagHandler))
+	r.Delete("/tags/{id}", app.requireActivatedUser(app.deleteTagHandler))
+
+	// Custom fields
+	r.Post("/custom-fields", app.requireActivatedUser(app.createCustomFieldHandler))
+	r.Get("/custom-fields", app.requireActivatedUser(app.listCustomFieldsHandler))
+	r.Get("/custom-fields/{id}", app.requireActivatedUser(app.getCustomFieldHandler))
+	r.Patch("/custom-fields/{id}", app.requireActivatedUser(app.updateCustomFieldHandler))
+	r.Delete("/custom-fields/{id}", app.requireActivatedUser(app.deleteCustomFieldHandler))
 
 	// Products
 	r.Get("/products/{id}", app.getProductsByQuoteIDHandler)
 	//TODO: 500 error for the created_at and updated_at
 	r.Patch("/products/{id}", app.updateProductHandler)
 	r.Delete("/products/{id}", app.deleteProductHandler)
-	return r
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+func (app application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 5, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(limit > 0 && limit <= 20, "limit", "must be between 1 and 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var owner *uuid.UUID
+	if user := app.contextGetUser(r); user.Role != data.RoleAdmin {
+		owner = &user.ID
+	}
+
+	groups, err := app.models.Search.Search(r.Context(), q, owner, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
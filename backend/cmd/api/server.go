@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -11,17 +16,104 @@ func (app *application) serve() error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.port),
 		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		IdleTimeout:  app.config.timeouts.idle,
+		ReadTimeout:  app.config.timeouts.read,
+		WriteTimeout: app.config.timeouts.write,
 	}
 
+	var metricsSrv *http.Server
+	if app.config.metrics.enabled && app.config.metrics.addr != "" {
+		metricsSrv = &http.Server{
+			Addr:         app.config.metrics.addr,
+			Handler:      app.metricsRoutes(),
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+			IdleTimeout:  app.config.timeouts.idle,
+			ReadTimeout:  app.config.timeouts.read,
+			WriteTimeout: app.config.timeouts.write,
+		}
+	}
+
+	app.background(app.purgeTrash)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		// Fail readiness first and give load balancers time to notice
+		// before we stop accepting connections.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.timeouts.drain)
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.timeouts.shutdown)
+		defer cancel()
+
+		// Stop accepting new connections and wait for in-flight
+		// requests to finish before the deadline.
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		if metricsSrv != nil {
+			err = metricsSrv.Shutdown(ctx)
+			if err != nil {
+				shutdownError <- err
+				return
+			}
+		}
+
+		app.logger.Info("completing background tasks", "addr", srv.Addr)
+
+		// Cancel background tasks and give them what is left of the
+		// deadline to wind down.
+		app.stopJobs()
+
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			shutdownError <- nil
+		case <-ctx.Done():
+			shutdownError <- fmt.Errorf("background tasks did not finish: %w", ctx.Err())
+		}
+	}()
+
+	if metricsSrv != nil {
+		go func() {
+			app.logger.Info("starting metrics server", "addr", metricsSrv.Addr)
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Error("metrics server error", "error", err)
+			}
+		}()
+	}
+
+	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
+
 	err := srv.ListenAndServe()
-	if errors.Is(err, http.ErrServerClosed) {
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
 		return err
 	}
 
-	err = errors.New("New Error")
+	app.logger.Info("stopped server", "addr", srv.Addr)
 
 	return nil
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+const (
+	// maxTaggedRecords bounds how many records one bulk tagging touches.
+	maxTaggedRecords = 1000
+	// maxTagChanges bounds how many tags one bulk tagging adds or removes.
+	maxTagChanges = 50
+)
+
+func (app application) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tag := &data.Tag{
+		Name:  input.Name,
+		Color: input.Color,
+	}
+
+	if tag.Color == "" {
+		tag.Color = data.DefaultTagColor
+	}
+
+	v := validator.New()
+
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.Insert(r.Context(), tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tags/%s", tag.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": tag}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTagsHandler lists tags with how many records carry each. ?q=
+// matches the start of names, for autocomplete.
+func (app application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	prefix := app.readString(qs, "q", "")
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 10, v),
+		Sort:         app.readString(qs, "sort", "name"),
+		SortSafeList: []string{"name", "-name", "usage", "-usage"},
+	}
+
+	v.Check(len(prefix) <= 50, "q", "must not be more than 50 bytes long")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tags, metadata, err := app.models.Tags.GetAll(r.Context(), prefix, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": tags, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTag loads the tag named by the id URL parameter, writing the error
+// response and returning nil if it is invalid or missing.
+func (app application) readTag(w http.ResponseWriter, r *http.Request) *data.Tag {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	tag, err := app.models.Tags.GetByID(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "tag")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return tag
+}
+
+func (app application) getTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := app.readTag(w, r)
+	if tag == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"data": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTagHandler renames or recolors a tag. Tags are shared by everyone,
+// so only admins may change them.
+func (app application) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	tag := app.readTag(w, r)
+	if tag == nil {
+		return
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.isAllNil(input) {
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
+		return
+	}
+
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+
+	if input.Color != nil {
+		tag.Color = *input.Color
+	}
+
+	v := validator.New()
+
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.Update(r.Context(), tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "tag")
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTagHandler deletes a tag, taking it off every record. Only admins
+// may delete tags.
+func (app application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetUser(r).Role != data.RoleAdmin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	tag := app.readTag(w, r)
+	if tag == nil {
+		return
+	}
+
+	err := app.models.Tags.Delete(r.Context(), tag.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "tag")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) tagCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	app.tagRecordsHandler(w, r, "companies")
+}
+
+func (app application) tagContactsHandler(w http.ResponseWriter, r *http.Request) {
+	app.tagRecordsHandler(w, r, "contacts")
+}
+
+func (app application) tagQuotesHandler(w http.ResponseWriter, r *http.Request) {
+	app.tagRecordsHandler(w, r, "quotes")
+}
+
+func (app application) tagProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	app.tagRecordsHandler(w, r, "projects")
+}
+
+// tagRecordsHandler adds the tags in add to, and removes those in remove
+// from, every record of entity in ids.
+func (app application) tagRecordsHandler(w http.ResponseWriter, r *http.Request, entity string) {
+	var input struct {
+		IDs    []string `json:"ids"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.IDs) > 0, "ids", "must contain at least one ID")
+	v.Check(len(input.IDs) <= maxTaggedRecords, "ids", fmt.Sprintf("must not contain more than %d IDs", maxTaggedRecords))
+	v.Check(len(input.Add)+len(input.Remove) > 0, "add", "add or remove must contain at least one tag")
+	v.Check(len(input.Add) <= maxTagChanges, "add", fmt.Sprintf("must not contain more than %d tags", maxTagChanges))
+	v.Check(len(input.Remove) <= maxTagChanges, "remove", fmt.Sprintf("must not contain more than %d tags", maxTagChanges))
+
+	for key, IDs := range map[string][]string{"ids": input.IDs, "add": input.Add, "remove": input.Remove} {
+		for _, ID := range IDs {
+			v.ValidateUUID(ID, key)
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	IDs, add, remove := uniqueUUIDs(input.IDs), uniqueUUIDs(input.Add), uniqueUUIDs(input.Remove)
+
+	for _, ID := range remove {
+		if slices.Contains(add, ID) {
+			v.AddError("remove", "must not contain tags that are being added")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	changes, err := app.models.Tags.Apply(r.Context(), entity, IDs, add, remove)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidUUID):
+			v.AddError("ids", fmt.Sprintf("must only contain existing %s, and add and remove existing tags", entity))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": changes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uniqueUUIDs parses IDs, which must be valid, dropping repeats.
+func uniqueUUIDs(IDs []string) []uuid.UUID {
+	unique := make([]uuid.UUID, 0, len(IDs))
+	for _, ID := range IDs {
+		parsed := uuid.MustParse(ID)
+		if !slices.Contains(unique, parsed) {
+			unique = append(unique, parsed)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// trashNames are the singular names of TrashEntities, for responses.
+var trashNames = map[string]string{
+	"companies": "company",
+	"contacts":  "contact",
+	"quotes":    "quote",
+	"projects":  "project",
+}
+
+// trashRetention is how long deleted records are kept, or 0 for ever.
+func (app application) trashRetention() time.Duration {
+	return time.Duration(app.config.trash.retentionDays) * 24 * time.Hour
+}
+
+// listTrashHandler lists soft-deleted records of every entity, or those
+// in ?type=, most recently deleted first. Users other than admins only see
+// records they own.
+func (app application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 10, v),
+		Sort:         "-deleted_at",
+		SortSafeList: []string{"-deleted_at"},
+	}
+
+	entities := data.TrashEntities
+	if types := qs.Get("type"); types != "" {
+		entities = strings.Split(types, ",")
+		for _, entity := range entities {
+			if !slices.Contains(data.TrashEntities, entity) {
+				v.AddError("type", fmt.Sprintf("must only contain %s", strings.Join(data.TrashEntities, ", ")))
+				break
+			}
+		}
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var owner *uuid.UUID
+	if user := app.contextGetUser(r); user.Role != data.RoleAdmin {
+		owner = &user.ID
+	}
+
+	items, metadata, err := app.models.Trash.GetAll(r.Context(), slices.Compact(slices.Sorted(slices.Values(entities))), owner, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retention := app.trashRetention(); retention > 0 {
+		for _, item := range items {
+			purgeAt := item.DeletedAt.Add(retention)
+			item.PurgeAt = &purgeAt
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": items, "metadata": metadata}, app.pageLinks(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) restoreCompanyHandler(w http.ResponseWriter, r *http.Request) {
+	app.restoreHandler(w, r, "companies")
+}
+
+func (app application) restoreContactHandler(w http.ResponseWriter, r *http.Request) {
+	app.restoreHandler(w, r, "contacts")
+}
+
+func (app application) restoreQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	app.restoreHandler(w, r, "quotes")
+}
+
+func (app application) restoreProjectHandler(w http.ResponseWriter, r *http.Request) {
+	app.restoreHandler(w, r, "projects")
+}
+
+// restoreHandler takes a record of entity out of the trash. Users other
+// than admins can only restore records they own.
+func (app application) restoreHandler(w http.ResponseWriter, r *http.Request, entity string) {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+	v.ValidateUUID(IDParam, "id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var owner *uuid.UUID
+	if user := app.contextGetUser(r); user.Role != data.RoleAdmin {
+		owner = &user.ID
+	}
+
+	err := app.models.Trash.Restore(r.Context(), entity, uuid.MustParse(IDParam), owner)
+	if err != nil {
+		var parentErr *data.DeletedParentError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, trashNames[entity])
+		case errors.As(err, &parentErr):
+			app.parentInTrashResponse(w, r, entity, parentErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": trashNames[entity] + " restored successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes records that have been in the trash for
+// longer than the retention period, every purge interval until ctx is
+// done. It does nothing if retention is disabled.
+func (app application) purgeTrash(ctx context.Context) {
+	retention := app.trashRetention()
+	if retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.models.Trash.Purge(ctx, time.Now().Add(-retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			app.logger.Error("trash purge failed", "error", err)
+		case err == nil:
+			args := []any{"retention_days", app.config.trash.retentionDays}
+			total := 0
+			for _, entity := range data.TrashEntities {
+				args = append(args, entity, purged[entity])
+				total += purged[entity]
+			}
+
+			if total > 0 {
+				app.logger.Info("trash purged", args...)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
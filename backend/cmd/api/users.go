@@ -3,14 +3,14 @@ package main
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/kharljhon14/zentrix/internal/data"
 	"github.com/kharljhon14/zentrix/internal/validator"
 )
 
+// registerUserHandler creates a user with the user role. Admins are made
+// with the admin-email setting, never by registering.
 func (app application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email     string `json:"email"`
@@ -21,7 +21,7 @@ func (app application) registerUserHandler(w http.ResponseWriter, r *http.Reques
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -29,43 +29,44 @@ func (app application) registerUserHandler(w http.ResponseWriter, r *http.Reques
 		Email:     input.Email,
 		FirstName: input.FirstName,
 		LastName:  input.LastName,
-		Role:      "admin",
+		Role:      data.RoleUser,
 	}
 
 	err = user.Password.Set(input.Password)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	v := validator.New()
 	if data.ValidateUser(v, user); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Users.Insert(r.Context(), user)
 	if err != nil {
-		fmt.Println(err)
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "email already exists")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	app.metrics.usersRegistered.Inc()
+
+	token, err := app.models.Tokens.New(r.Context(), user.ID, app.config.tokens.activationTTL, data.ScopeActivation)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user, "token": token}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
@@ -76,25 +77,25 @@ func (app application) activateUserHandler(w http.ResponseWriter, r *http.Reques
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	v := validator.New()
 
 	if data.ValidatePlainTextToken(v, input.PlainTextToken); !v.Valid() {
-		app.failedValidationResponse(w, v.Errors)
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	user, err := app.models.Tokens.GetForToken(data.ScopeActivation, input.PlainTextToken)
+	user, err := app.models.Tokens.GetForToken(r.Context(), data.ScopeActivation, input.PlainTextToken)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			v.AddError("token", "invalid or expired activation token")
-			app.failedValidationResponse(w, v.Errors)
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
-			app.serverErrorResponse(w, err)
+			app.serverErrorResponse(w, r, err)
 		}
 
 		return
@@ -102,21 +103,21 @@ func (app application) activateUserHandler(w http.ResponseWriter, r *http.Reques
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
-		app.serverErrorResponse(w, err)
+		app.serverErrorResponse(w, r, err)
 	}
 
 }
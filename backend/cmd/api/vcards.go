@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+	"github.com/kharljhon14/zentrix/internal/vcard"
+)
+
+// freeMailDomains are webmail providers, whose addresses say nothing about
+// where a contact works.
+var freeMailDomains = []string{
+	"aol.com",
+	"gmail.com",
+	"googlemail.com",
+	"gmx.com",
+	"hotmail.com",
+	"icloud.com",
+	"live.com",
+	"mail.com",
+	"me.com",
+	"outlook.com",
+	"proton.me",
+	"protonmail.com",
+	"yahoo.com",
+	"yandex.com",
+}
+
+func contactVCard(contact *data.ContactWithCompanyName) vcard.Card {
+	card := vcard.Card{
+		UID:   "urn:uuid:" + contact.ID.String(),
+		Name:  contact.Name,
+		Email: contact.Email,
+		Title: contact.Title,
+		Rev:   contact.UpdatedAt,
+	}
+
+	if contact.CompanyName != nil {
+		card.Org = *contact.CompanyName
+	}
+
+	return card
+}
+
+func (app application) getContactVCardHandler(w http.ResponseWriter, r *http.Request) {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	contact, err := app.models.Contacts.GetByIDWithCompanyName(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "contact")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", vcard.MediaType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": contact.Name + ".vcf",
+	}))
+
+	err = vcard.Encode(w, contactVCard(contact))
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportVCards writes every contact matching filters as one vCard file,
+// like exportRows does for CSV and XLSX.
+func (app application) exportVCards(w http.ResponseWriter, r *http.Request, filters data.Filters) {
+	rc := http.NewResponseController(w)
+	out := deadlineWriter{w: w, rc: rc, timeout: app.config.timeouts.write}
+
+	exported := 0
+	begin := func() {
+		w.Header().Set("Content-Type", vcard.MediaType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="contacts-%s.vcf"`, time.Now().UTC().Format(time.DateOnly)))
+	}
+
+	err := app.models.Contacts.Export(context.WithoutCancel(r.Context()), filters, func(contact *data.ContactWithCompanyName) error {
+		if exported == 0 {
+			begin()
+		}
+		exported++
+
+		err := vcard.Encode(out, contactVCard(contact))
+		if err != nil {
+			return err
+		}
+
+		if exported%exportFlushRows == 0 {
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	switch {
+	case err != nil && exported == 0:
+		app.serverErrorResponse(w, r, err)
+	case err != nil:
+		app.logError(r, fmt.Errorf("export failed: %w", err))
+		panic(http.ErrAbortHandler)
+	case exported == 0:
+		begin()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func isVCardFile(header *multipart.FileHeader) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	switch mediaType {
+	case vcard.MediaType, "text/x-vcard", "text/directory":
+		return true
+	}
+
+	return strings.EqualFold(filepath.Ext(header.Filename), ".vcf")
+}
+
+// vcardRecords turns cards into import rows of name, email, title, status
+// and company_id. Cards carry no status, so every contact gets status. ORG
+// is matched to an existing company by name, ignoring case, or failing
+// that the contact's email domain is matched to a company's email or
+// website domain. Contacts matching no company keep any they have.
+func (app application) vcardRecords(ctx context.Context, cards []vcard.Card, status string) ([]string, [][]string, error) {
+	var names, domains []string
+	for _, card := range cards {
+		if card.Org != "" {
+			names = append(names, strings.ToLower(card.Org))
+		}
+		if domain := emailDomain(card.Email); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	byName, byDomain, err := app.models.Companies.Match(ctx, names, domains)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := []string{"name", "email", "title", "status", "company_id"}
+	records := make([][]string, len(cards))
+
+	for i, card := range cards {
+		companyID, ok := byName[strings.ToLower(card.Org)]
+		if !ok || card.Org == "" {
+			companyID, ok = byDomain[emailDomain(card.Email)]
+		}
+
+		company := ""
+		if ok {
+			company = companyID.String()
+		}
+
+		records[i] = []string{card.Name, card.Email, card.Title, status, company}
+	}
+
+	return header, records, nil
+}
+
+// emailDomain returns the lower-cased domain of email, or "" if it has none
+// or belongs to a webmail provider.
+func emailDomain(email string) string {
+	_, domain, found := strings.Cut(email, "@")
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	if !found || slices.Contains(freeMailDomains, domain) {
+		return ""
+	}
+
+	return domain
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiVersions lists every version the server can serve, oldest first.
+var apiVersions = []string{"v1"}
+
+const (
+	apiVersionHeader = "API-Version"
+	vendorMediaType  = "application/vnd.zentrix."
+)
+
+// legacyRoutesDeprecatedAt is when the unversioned routes were superseded
+// by /v1.
+var legacyRoutesDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// requestedVersion returns the API version the client asked for, either
+// through the API-Version header ("1" or "v1") or a vendor media type in
+// Accept such as application/vnd.zentrix.v1+json. It returns "" when the
+// client didn't ask for one.
+func requestedVersion(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get(apiVersionHeader)); v != "" {
+		return "v" + strings.TrimPrefix(strings.ToLower(v), "v")
+	}
+
+	for part := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		if v, ok := strings.CutPrefix(mediaType, vendorMediaType); ok {
+			v, _, _ = strings.Cut(v, "+")
+			return v
+		}
+	}
+
+	return ""
+}
+
+// versionedPath reports whether path is served under one of apiVersions,
+// such as /v1/companies.
+func versionedPath(path string) bool {
+	for _, v := range apiVersions {
+		if path == "/"+v || strings.HasPrefix(path, "/"+v+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateVersion tags responses with the version being served and
+// rejects requests that asked for a different one, so a client pinned to
+// v2 never silently receives v1 payloads.
+func (app *application) negotiateVersion(served string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", apiVersionHeader)
+			w.Header().Set(apiVersionHeader, served)
+
+			requested := requestedVersion(r)
+			if requested != "" && requested != served {
+				app.unsupportedVersionResponse(w, r, requested)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deprecation describes a route, or a whole version, that clients should
+// move away from.
+type deprecation struct {
+	// at is when the deprecation took effect.
+	at time.Time
+	// sunset is when the route stops being served. Zero if not scheduled.
+	sunset time.Time
+	// successor returns the replacement for the requested resource, sent
+	// as a successor-version link. It may be nil.
+	successor func(r *http.Request) string
+}
+
+// deprecate adds Deprecation (RFC 9745), Sunset (RFC 8594) and successor
+// Link headers to every response and counts the requests so we can tell
+// when it is safe to remove the route.
+func (app *application) deprecate(d deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.at.Unix()))
+			if !d.sunset.IsZero() {
+				w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.successor != nil {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.successor(r)))
+			}
+
+			next.ServeHTTP(w, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			app.metrics.deprecatedRequests.WithLabelValues(r.Method, route).Inc()
+		})
+	}
+}
+
+// legacyRoutes serves the API at the root, as it was before /v1 existed.
+// Only the routes that existed then are mounted; endpoints added since are
+// only served under a version.
+func (app *application) legacyRoutes(r chi.Router) {
+	r.Use(app.negotiateVersion("v1"))
+	r.Use(app.deprecate(deprecation{
+		at:     legacyRoutesDeprecatedAt,
+		sunset: app.config.api.legacySunset,
+		successor: func(r *http.Request) string {
+			return "/v1" + r.URL.RequestURI()
+		},
+	}))
+
+	r.Get("/healthcheck", app.healthCheckHandler)
+
+	// User auth
+	r.Post("/register", app.registerUserHandler)
+	r.Put("/activate", app.activateUserHandler)
+
+	// Companies
+	r.Post("/companies", app.createCompanyHandler)
+	r.Get("/companies", app.listCompaniesHandler)
+	r.Get("/companies/{id}", app.getCompanyByIDHandler)
+	r.Patch("/companies/{id}", app.updatedCompanyHandler)
+	r.Delete("/companies/{id}", app.deleteCompanyHandler)
+
+	// Contacts
+	r.Post("/contacts", app.createContactHandler)
+	r.Get("/contacts", app.listContactsHandler)
+	r.Get("/contacts/{id}", app.getContactByIDHandler)
+	r.Patch("/contacts/{id}", app.updateContactHandler)
+	r.Delete("/contacts/{id}", app.deleteContactHandler)
+
+	// Quotes
+	r.Post("/quotes", app.createQuoteHandler)
+	r.Get("/quotes/{id}", app.getQuoteByIDHandler)
+	r.Get("/quotes", app.listQuotesHandler)
+	r.Patch("/quotes/{id}", app.updateQuoteHandler)
+	r.Delete("/quotes/{id}", app.deleteQuoteHandler)
+
+	// Products
+	r.Get("/products/{id}", app.getProductsByQuoteIDHandler)
+	r.Patch("/products/{id}", app.updateProductHandler)
+	r.Delete("/products/{id}", app.deleteProductHandler)
+}
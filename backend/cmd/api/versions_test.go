@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLegacyRoutesAreTheBaselineSet(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var cfg config
+	cfg.api.legacyRoutes = true
+
+	app := &application{config: cfg, metrics: newMetrics(db)}
+
+	var routed []string
+	err = chi.Walk(app.routes().(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed = append(routed, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var legacy []string
+	for _, route := range routed {
+		method, path, _ := strings.Cut(route, " ")
+		if !strings.HasPrefix(path, "/v1/") && slices.Contains(routed, method+" /v1"+path) {
+			legacy = append(legacy, route)
+		}
+	}
+	slices.Sort(legacy)
+
+	want := []string{
+		"DELETE /companies/{id}",
+		"DELETE /contacts/{id}",
+		"DELETE /products/{id}",
+		"DELETE /quotes/{id}",
+		"GET /companies",
+		"GET /companies/{id}",
+		"GET /contacts",
+		"GET /contacts/{id}",
+		"GET /healthcheck",
+		"GET /products/{id}",
+		"GET /quotes",
+		"GET /quotes/{id}",
+		"PATCH /companies/{id}",
+		"PATCH /contacts/{id}",
+		"PATCH /products/{id}",
+		"PATCH /quotes/{id}",
+		"POST /companies",
+		"POST /contacts",
+		"POST /quotes",
+		"POST /register",
+		"PUT /activate",
+	}
+
+	if !slices.Equal(legacy, want) {
+		t.Errorf("unversioned routes are\n%s\nwant\n%s", strings.Join(legacy, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/data"
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// listFilters reads the list parameters of each entity saved views apply
+// to.
+var listFilters = map[string]func(application, *http.Request, url.Values, []*data.CustomField, *validator.Validator) data.Filters{
+	"companies": application.companyListFilters,
+	"contacts":  application.contactListFilters,
+	"quotes":    application.quoteListFilters,
+}
+
+// viewColumns are the columns saved views of each entity may show, those
+// its list endpoint exports.
+var viewColumns = map[string][]string{
+	"companies": columnNames(companyExportColumns),
+	"contacts":  columnNames(contactExportColumns),
+	"quotes":    columnNames(quoteExportColumns),
+}
+
+// listQuery returns the query parameters of a list request for entity.
+// With ?view=<id> the saved view's parameters are applied first and any
+// given in the request override them. A view the user can't see is
+// reported as not found.
+func (app application) listQuery(w http.ResponseWriter, r *http.Request, entity string) (url.Values, bool) {
+	qs := r.URL.Query()
+	if !qs.Has("view") {
+		return qs, true
+	}
+
+	v := validator.New()
+
+	v.ValidateUUID(qs.Get("view"), "view")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	view, err := app.models.Views.GetByID(r.Context(), uuid.MustParse(qs.Get("view")))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "view")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !view.VisibleTo(app.contextGetUser(r)) {
+		app.notFoundResponse(w, r, "view")
+		return nil, false
+	}
+
+	if view.Entity != entity {
+		v.AddError("view", fmt.Sprintf("is a view of %s", view.Entity))
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	merged := view.Query()
+	for key, values := range qs {
+		if key != "view" {
+			merged[key] = values
+		}
+	}
+
+	return merged, true
+}
+
+// validateViewQuery checks the view's filters, sort, search and columns the
+// way its list endpoint would, so that a saved view can always be applied.
+func (app application) validateViewQuery(r *http.Request, view *data.SavedView, v *validator.Validator) error {
+	if !v.Valid() {
+		return nil
+	}
+
+	fields, err := app.models.CustomFields.GetAll(r.Context(), view.Entity)
+	if err != nil {
+		return err
+	}
+
+	list := validator.New()
+	filters := listFilters[view.Entity](app, r, view.Query(), fields, list)
+
+	for key := range view.Filters {
+		if _, ok := filters.FilterSafeList[key]; !ok {
+			v.AddError("filters."+key, "is not filterable")
+		}
+	}
+
+	for _, column := range view.Columns {
+		if !slices.Contains(viewColumns[view.Entity], column) {
+			v.AddError("columns", fmt.Sprintf("%s is not a column of %s", column, view.Entity))
+			break
+		}
+	}
+
+	data.ValidateFilters(list, filters)
+	for key, message := range list.Errors {
+		if _, ok := view.Filters[key]; ok {
+			key = "filters." + key
+		}
+		v.AddError(key, message)
+	}
+
+	return nil
+}
+
+func (app application) createViewHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Entity  string              `json:"entity"`
+		Name    string              `json:"name"`
+		Filters map[string][]string `json:"filters"`
+		Sort    string              `json:"sort"`
+		Search  string              `json:"q"`
+		Columns []string            `json:"columns"`
+		Shared  bool                `json:"shared"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	view := &data.SavedView{
+		OwnerID: app.contextGetUser(r).ID,
+		Entity:  input.Entity,
+		Name:    input.Name,
+		Filters: input.Filters,
+		Sort:    input.Sort,
+		Search:  input.Search,
+		Columns: input.Columns,
+		Shared:  input.Shared,
+	}
+
+	if view.Filters == nil {
+		view.Filters = map[string][]string{}
+	}
+	if view.Columns == nil {
+		view.Columns = []string{}
+	}
+
+	v := validator.New()
+
+	view.ValidateSavedView(v)
+
+	err = app.validateViewQuery(r, view, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Views.Insert(r.Context(), view)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/views/%s", view.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": view}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) listViewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	entity := app.readString(r.URL.Query(), "entity", "")
+	if entity != "" {
+		_, ok := listFilters[entity]
+		v.Check(ok, "entity", "must be one of companies, contacts or quotes")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	views, err := app.models.Views.GetAllVisible(r.Context(), app.contextGetUser(r).ID, entity)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": views}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readView loads the view named by the id URL parameter, writing the error
+// response and returning nil if it is invalid or not visible to the user.
+func (app application) readView(w http.ResponseWriter, r *http.Request) *data.SavedView {
+	IDParam := chi.URLParam(r, "id")
+
+	v := validator.New()
+
+	v.Check(IDParam != "", "id", "id is required")
+	v.ValidateUUID(IDParam, "id")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	view, err := app.models.Views.GetByID(r.Context(), uuid.MustParse(IDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "view")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	if !view.VisibleTo(app.contextGetUser(r)) {
+		app.notFoundResponse(w, r, "view")
+		return nil
+	}
+
+	return view
+}
+
+func (app application) getViewHandler(w http.ResponseWriter, r *http.Request) {
+	view := app.readView(w, r)
+	if view == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"data": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) updateViewHandler(w http.ResponseWriter, r *http.Request) {
+	view := app.readView(w, r)
+	if view == nil {
+		return
+	}
+
+	if !view.EditableBy(app.contextGetUser(r)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name    *string             `json:"name"`
+		Filters map[string][]string `json:"filters"`
+		Sort    *string             `json:"sort"`
+		Search  *string             `json:"q"`
+		Columns []string            `json:"columns"`
+		Shared  *bool               `json:"shared"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.isAllNil(input) {
+		app.badRequestResponse(w, r, errors.New("body must not be empty"))
+		return
+	}
+
+	if input.Name != nil {
+		view.Name = *input.Name
+	}
+
+	if input.Filters != nil {
+		view.Filters = input.Filters
+	}
+
+	if input.Sort != nil {
+		view.Sort = *input.Sort
+	}
+
+	if input.Search != nil {
+		view.Search = *input.Search
+	}
+
+	if input.Columns != nil {
+		view.Columns = input.Columns
+	}
+
+	if input.Shared != nil {
+		view.Shared = *input.Shared
+	}
+
+	v := validator.New()
+
+	view.ValidateSavedView(v)
+
+	err = app.validateViewQuery(r, view, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Views.Update(r.Context(), view)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "view")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": view}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app application) deleteViewHandler(w http.ResponseWriter, r *http.Request) {
+	view := app.readView(w, r)
+	if view == nil {
+		return
+	}
+
+	if !view.EditableBy(app.contextGetUser(r)) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Views.Delete(r.Context(), view.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.notFoundResponse(w, r, "view")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "view deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions.
+const (
+	AuditCompanyMerge  = "company.merge"
+	AuditContactMerge  = "contact.merge"
+	AuditCompanyDelete = "company.delete"
+)
+
+// AuditEntry records a change that can't be read back from the records it
+// touched, such as the company a merge soft-deleted.
+type AuditEntry struct {
+	ActorID  uuid.UUID
+	Action   string
+	Entity   string
+	EntityID uuid.UUID
+	Details  any
+}
+
+// insertAudit writes entry as part of tx, so the entry exists if and only
+// if the change does.
+func insertAudit(ctx context.Context, tx *sql.Tx, entry AuditEntry) error {
+	query := `
+		INSERT INTO audit_log
+		(actor_id, action, entity, entity_id, details)
+		VALUES
+		($1, $2, $3, $4, $5)
+	`
+
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	var actor *uuid.UUID
+	if entry.ActorID != uuid.Nil {
+		actor = &entry.ActorID
+	}
+
+	_, err = tx.ExecContext(ctx, query, actor, entry.Action, entry.Entity, entry.EntityID, details)
+	return err
+}
@@ -9,34 +9,40 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/kharljhon14/zentrix/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Company struct {
 	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	Address      string    `json:"address"`
+	Name         string    `json:"name" validate:"required,max=255"`
+	Address      string    `json:"address" validate:"required,max=255"`
 	SalesOwner   uuid.UUID `json:"sales_owner"`
-	Email        string    `json:"email"`
-	CompanySize  string    `json:"company_size"`
-	Industry     string    `json:"industry"`
-	BusinessType string    `json:"business_type"`
-	Country      string    `json:"country"`
+	Email        string    `json:"email" validate:"required,max=255,email"`
+	CompanySize  string    `json:"company_size" validate:"required,max=255"`
+	Industry     string    `json:"industry" validate:"required,max=255"`
+	BusinessType string    `json:"business_type" validate:"required,max=255"`
+	Country      string    `json:"country" validate:"required,max=255"`
 	Image        *string   `json:"image"`
 	Website      *string   `json:"website"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// ParentID is the company this one is a subsidiary of, if any.
+	ParentID     *uuid.UUID   `json:"parent_id"`
+	CustomFields CustomFields `json:"custom_fields"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 type CompanyModel struct {
 	DB *sql.DB
 }
 
-func (c CompanyModel) Insert(company *Company) error {
+// Insert creates company. A parent must be a company that isn't deleted,
+// or ErrInvalidUUID is returned.
+func (c CompanyModel) Insert(ctx context.Context, company *Company) error {
 	query := `
 		INSERT INTO companies 
-		(name, address, sales_owner, email, company_size, industry, business_type, country, image, website)
+		(name, address, sales_owner, email, company_size, industry, business_type, country, image, website, parent_id, custom_fields)
 		VALUES 
-		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -51,12 +57,33 @@ func (c CompanyModel) Insert(company *Company) error {
 		company.Country,
 		company.Image,
 		company.Website,
+		company.ParentID,
+		company.CustomFields,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
+	ctx, span := startSpan(ctx, "CompanyModel.Insert", query)
+	defer span.End()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	if company.ParentID != nil {
+		err = checkParent(ctx, tx, uuid.Nil, *company.ParentID)
+		switch {
+		case errors.Is(err, ErrInvalidUUID), errors.Is(err, ErrCompanyCycle):
+			return err
+		case err != nil:
+			return spanError(span, err)
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&company.ID,
 		&company.CreatedAt,
 		&company.UpdatedAt,
@@ -68,31 +95,120 @@ func (c CompanyModel) Insert(company *Company) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return sql.ErrNoRows
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
+	if err = tx.Commit(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
 	return nil
 }
 
+// Upsert inserts company or, when its email is taken, updates that company
+// instead, restoring it if it was deleted. It reports whether a company was
+// created. A zero SalesOwner keeps the existing owner and gives new
+// companies defaultOwner; nil Image and Website keep the existing values.
+func (c CompanyModel) Upsert(ctx context.Context, company *Company, defaultOwner uuid.UUID) (bool, error) {
+	query := `
+		INSERT INTO companies
+		(name, address, sales_owner, email, company_size, industry, business_type, country, image, website)
+		VALUES
+		($1, $2, COALESCE($3::uuid, $11::uuid), $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (email) DO UPDATE
+		SET name = EXCLUDED.name,
+		address = EXCLUDED.address,
+		sales_owner = COALESCE($3::uuid, companies.sales_owner),
+		company_size = EXCLUDED.company_size,
+		industry = EXCLUDED.industry,
+		business_type = EXCLUDED.business_type,
+		country = EXCLUDED.country,
+		image = COALESCE(EXCLUDED.image, companies.image),
+		website = COALESCE(EXCLUDED.website, companies.website),
+		updated_at = NOW(),
+		deleted_at = NULL
+		RETURNING id, sales_owner, created_at, updated_at, xmax = 0
+	`
+
+	var salesOwner *uuid.UUID
+	if company.SalesOwner != uuid.Nil {
+		salesOwner = &company.SalesOwner
+	}
+
+	args := []any{
+		company.Name,
+		company.Address,
+		salesOwner,
+		company.Email,
+		company.CompanySize,
+		company.Industry,
+		company.BusinessType,
+		company.Country,
+		company.Image,
+		company.Website,
+		defaultOwner,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.Upsert", query)
+	defer span.End()
+
+	var created bool
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
+		&company.ID,
+		&company.SalesOwner,
+		&company.CreatedAt,
+		&company.UpdatedAt,
+		&created,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "companies" violates foreign key constraint "companies_sales_owner_fkey"`:
+			return false, ErrInvalidUUID
+		default:
+			return false, spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return created, nil
+}
+
+// ExistingEmails returns which of emails belong to a company, deleted or
+// not.
+func (c CompanyModel) ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	return existingEmails(ctx, c.DB, "CompanyModel.ExistingEmails", "companies", emails)
+}
+
 type CompanyWithSalesOwner struct {
-	ID             uuid.UUID  `json:"id"`
-	Name           string     `json:"name"`
-	Address        string     `json:"address"`
-	SalesOwner     *uuid.UUID `json:"sales_owner"`
-	SalesOwnerName *string    `json:"sales_owner_name"`
-	Email          string     `json:"email"`
-	CompanySize    string     `json:"company_size"`
-	Industry       string     `json:"industry"`
-	BusinessType   string     `json:"business_type"`
-	Country        string     `json:"country"`
-	Image          *string    `json:"image"`
-	Website        *string    `json:"website"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID             uuid.UUID    `json:"id"`
+	Name           string       `json:"name"`
+	Address        string       `json:"address"`
+	SalesOwner     *uuid.UUID   `json:"sales_owner"`
+	SalesOwnerName *string      `json:"sales_owner_name"`
+	Email          string       `json:"email"`
+	CompanySize    string       `json:"company_size"`
+	Industry       string       `json:"industry"`
+	BusinessType   string       `json:"business_type"`
+	Country        string       `json:"country"`
+	Image          *string      `json:"image"`
+	Website        *string      `json:"website"`
+	ParentID       *uuid.UUID   `json:"parent_id"`
+	Tags           TagRefs      `json:"tags"`
+	CustomFields   CustomFields `json:"custom_fields"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Rank           *float64     `json:"rank,omitempty"`
+	Highlight      *string      `json:"highlight,omitempty"`
 }
 
-func (c CompanyModel) GetByID(ID uuid.UUID) (*Company, error) {
+func (c CompanyModel) GetByID(ctx context.Context, ID uuid.UUID) (*Company, error) {
 	query := `
 		SELECT 
 			id, 
@@ -106,15 +222,20 @@ func (c CompanyModel) GetByID(ID uuid.UUID) (*Company, error) {
 			country, 
 			image, 
 			website,
+			parent_id,
+			custom_fields,
 			created_at, 
 			updated_at
 		FROM companies
-		WHERE ID = $1
+		WHERE ID = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "CompanyModel.GetByID", query)
+	defer span.End()
+
 	var company Company
 	err := c.DB.QueryRowContext(ctx, query, ID).Scan(
 		&company.ID,
@@ -128,17 +249,21 @@ func (c CompanyModel) GetByID(ID uuid.UUID) (*Company, error) {
 		&company.Country,
 		&company.Image,
 		&company.Website,
+		&company.ParentID,
+		&company.CustomFields,
 		&company.CreatedAt,
 		&company.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &company, nil
 }
 
-func (c CompanyModel) GetByIDWithSalesOwner(ID uuid.UUID) (*CompanyWithSalesOwner, error) {
+func (c CompanyModel) GetByIDWithSalesOwner(ctx context.Context, ID uuid.UUID) (*CompanyWithSalesOwner, error) {
 	query := `
 		SELECT 
 			c.id, 
@@ -153,6 +278,9 @@ func (c CompanyModel) GetByIDWithSalesOwner(ID uuid.UUID) (*CompanyWithSalesOwne
 			c.country, 
 			c.image, 
 			c.website,
+			c.parent_id,
+			` + tagsColumn("companies", "c.id") + `,
+			c.custom_fields,
 			c.created_at, 
 			c.updated_at
 		FROM companies c
@@ -161,9 +289,12 @@ func (c CompanyModel) GetByIDWithSalesOwner(ID uuid.UUID) (*CompanyWithSalesOwne
 		WHERE c.id = $1 AND c.deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "CompanyModel.GetByIDWithSalesOwner", query)
+	defer span.End()
+
 	var company CompanyWithSalesOwner
 	err := c.DB.QueryRowContext(ctx, query, ID).Scan(
 		&company.ID,
@@ -178,20 +309,45 @@ func (c CompanyModel) GetByIDWithSalesOwner(ID uuid.UUID) (*CompanyWithSalesOwne
 		&company.Country,
 		&company.Image,
 		&company.Website,
+		&company.ParentID,
+		&company.Tags,
+		&company.CustomFields,
 		&company.CreatedAt,
 		&company.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &company, nil
 }
 
-func (c CompanyModel) GetAll(filters Filters) ([]*CompanyWithSalesOwner, Metadata, error) {
+// listQuery returns the query GetAll and Export run for filters, the FROM
+// clause it selects from and how many of args that clause uses.
+func (c CompanyModel) listQuery(filters Filters) (string, string, []any, int, error) {
+	conditions, args := filters.where(nil)
+	match, rank, headline, args := filters.search(companySearch, args)
+	countArgs := len(args)
+
+	from := fmt.Sprintf(`
+		FROM companies c
+		JOIN users u
+		ON c.sales_owner = u.id
+		WHERE c.deleted_at IS NULL AND %s AND %s`, conditions, match)
+
+	sortExpr := filters.sortExpr("c", map[string]string{"relevance": rank})
+
+	after, window, args, err := filters.window(sortExpr, "c.id", args)
+	if err != nil {
+		return "", "", nil, 0, err
+	}
+
 	query := fmt.Sprintf(`
 		SELECT 
-			count(c.id) over(),
+			%s,
+			%s::text,
 			c.id, 
 			c.name, 
 			c.address,
@@ -204,63 +360,156 @@ func (c CompanyModel) GetAll(filters Filters) ([]*CompanyWithSalesOwner, Metadat
 			c.country, 
 			c.image, 
 			c.website,
+			c.parent_id,
+			%s,
+			c.custom_fields,
 			c.created_at, 
-			c.updated_at
-		FROM companies c
-		JOIN users u
-		ON c.sales_owner = u.id
-		WHERE c.deleted_at IS NULL
-		ORDER BY %s %s, c.created_at DESC
-		LIMIT $1 OFFSET $2
-	`, filters.sortColumn(), filters.sortDirection())
+			c.updated_at,
+			%s,
+			%s
+		%s AND %s
+		%s
+	`, filters.countExpr("c.id"), sortExpr, tagsColumn("companies", "c.id"), rank, headline, from, after, window)
+
+	return query, from, args, countArgs, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func scanCompanyWithSalesOwner(rows *sql.Rows, totalRecords *int, sortValue *string) (*CompanyWithSalesOwner, error) {
+	var company CompanyWithSalesOwner
+
+	err := rows.Scan(
+		totalRecords,
+		sortValue,
+		&company.ID,
+		&company.Name,
+		&company.Address,
+		&company.SalesOwner,
+		&company.SalesOwnerName,
+		&company.Email,
+		&company.CompanySize,
+		&company.BusinessType,
+		&company.Industry,
+		&company.Country,
+		&company.Image,
+		&company.Website,
+		&company.ParentID,
+		&company.Tags,
+		&company.CustomFields,
+		&company.CreatedAt,
+		&company.UpdatedAt,
+		&company.Rank,
+		&company.Highlight,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &company, nil
+}
+
+func (c CompanyModel) GetAll(ctx context.Context, filters Filters) ([]*CompanyWithSalesOwner, Metadata, error) {
+	query, from, args, countArgs, err := c.listQuery(filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	args := []any{filters.limit(), filters.offset()}
+	ctx, span := startSpan(ctx, "CompanyModel.GetAll", query)
+	defer span.End()
 
 	rows, err := c.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, spanError(span, err)
 	}
 	defer rows.Close()
 
 	totalRecords := 0
 	companies := []*CompanyWithSalesOwner{}
+	sortValues := []string{}
 
 	for rows.Next() {
-		var company CompanyWithSalesOwner
-
-		err := rows.Scan(
-			&totalRecords,
-			&company.ID,
-			&company.Name,
-			&company.Address,
-			&company.SalesOwner,
-			&company.SalesOwnerName,
-			&company.Email,
-			&company.CompanySize,
-			&company.BusinessType,
-			&company.Industry,
-			&company.Country,
-			&company.Image,
-			&company.Website,
-			&company.CreatedAt,
-			&company.UpdatedAt,
-		)
+		var sortValue string
+
+		company, err := scanCompanyWithSalesOwner(rows, &totalRecords, &sortValue)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, spanError(span, err)
 		}
 
-		companies = append(companies, &company)
+		companies = append(companies, company)
+		sortValues = append(sortValues, sortValue)
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	if filters.Keyset && filters.IncludeTotal {
+		err = c.DB.QueryRowContext(ctx, "SELECT count(*) "+from, args[:countArgs]...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+	}
+
+	companies, metadata := paginate(filters, companies, sortValues, func(c *CompanyWithSalesOwner) uuid.UUID { return c.ID }, totalRecords)
+
+	spanRows(span, len(companies))
 
 	return companies, metadata, nil
 }
 
-func (c CompanyModel) Update(company *Company) error {
+// Export calls fn with every company matching filters, in order, as rows
+// are read from the database. Paging is ignored.
+func (c CompanyModel) Export(ctx context.Context, filters Filters, fn func(*CompanyWithSalesOwner) error) error {
+	filters.unpaged = true
+
+	query, _, args, _, err := c.listQuery(filters)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.Export", query)
+	defer span.End()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer rows.Close()
+
+	var totalRecords, exported int
+	var sortValue string
+
+	for rows.Next() {
+		company, err := scanCompanyWithSalesOwner(rows, &totalRecords, &sortValue)
+		if err != nil {
+			return spanError(span, err)
+		}
+
+		err = fn(company)
+		if err != nil {
+			return spanError(span, err)
+		}
+		exported++
+	}
+
+	if err = rows.Err(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, exported)
+
+	return nil
+}
+
+// Update saves company. A new parent must be a company that isn't deleted,
+// or ErrInvalidUUID is returned, and mustn't be the company or one below
+// it, or ErrCompanyCycle is. The parent is only checked when it changes.
+func (c CompanyModel) Update(ctx context.Context, company *Company) error {
 	query := `
 		UPDATE companies
 		SET name = $1,
@@ -272,8 +521,10 @@ func (c CompanyModel) Update(company *Company) error {
 		country = $7,
 		image = $8,
 		website = $9,
+		parent_id = $11,
+		custom_fields = $12,
 		updated_at = NOW()
-		WHERE id = $10
+		WHERE id = $10 AND deleted_at IS NULL
 		RETURNING updated_at;
 	`
 
@@ -288,12 +539,44 @@ func (c CompanyModel) Update(company *Company) error {
 		company.Image,
 		company.Website,
 		company.ID,
+		company.ParentID,
+		company.CustomFields,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
+	ctx, span := startSpan(ctx, "CompanyModel.Update", query)
+	defer span.End()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	var parentID *uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT parent_id FROM companies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, company.ID).Scan(&parentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return sql.ErrNoRows
+		default:
+			return spanError(span, err)
+		}
+	}
+
+	if company.ParentID != nil && (parentID == nil || *parentID != *company.ParentID) {
+		err = checkParent(ctx, tx, company.ID, *company.ParentID)
+		switch {
+		case errors.Is(err, ErrInvalidUUID), errors.Is(err, ErrCompanyCycle):
+			return err
+		case err != nil:
+			return spanError(span, err)
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&company.UpdatedAt,
 	)
 	if err != nil {
@@ -304,64 +587,241 @@ func (c CompanyModel) Update(company *Company) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return sql.ErrNoRows
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
-	return nil
+	if err = tx.Commit(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
 
+	return nil
 }
 
-func (c CompanyModel) Delete(ID uuid.UUID) error {
+// Match returns the IDs of companies whose lower-cased name is in names,
+// and of those whose email or website domain is in domains, keyed by the
+// name or domain. When several companies match, the oldest wins.
+func (c CompanyModel) Match(ctx context.Context, names, domains []string) (map[string]uuid.UUID, map[string]uuid.UUID, error) {
 	query := `
-		UPDATE companies
-		set deleted_at = NOW()
-		WHERE id = $1 AND deleted_at IS NULL
+		SELECT id, lower(name), lower(split_part(email, '@', 2)), website_domain
+		FROM (
+			SELECT *, substring(lower(website) from '^(?:[a-z]+://)?(?:www\.)?([^/:?#]+)') AS website_domain
+			FROM companies
+			WHERE deleted_at IS NULL
+		) c
+		WHERE lower(name) = ANY($1)
+		OR lower(split_part(email, '@', 2)) = ANY($2)
+		OR website_domain = ANY($2)
+		ORDER BY created_at, id
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.ExecContext(ctx, query, ID)
+	ctx, span := startSpan(ctx, "CompanyModel.Match", query)
+	defer span.End()
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(names), pq.Array(domains))
 	if err != nil {
-		return err
+		return nil, nil, spanError(span, err)
 	}
+	defer rows.Close()
 
-	affected, err := rows.RowsAffected()
-	if err != nil {
-		return err
+	byName := make(map[string]uuid.UUID)
+	byDomain := make(map[string]uuid.UUID)
+
+	first := func(m map[string]uuid.UUID, key string, ID uuid.UUID) {
+		if _, ok := m[key]; !ok {
+			m[key] = ID
+		}
+	}
+
+	matched := 0
+	for rows.Next() {
+		var ID uuid.UUID
+		var name, emailDomain string
+		var websiteDomain *string
+
+		err := rows.Scan(&ID, &name, &emailDomain, &websiteDomain)
+		if err != nil {
+			return nil, nil, spanError(span, err)
+		}
+
+		first(byName, name, ID)
+		first(byDomain, emailDomain, ID)
+		if websiteDomain != nil {
+			first(byDomain, *websiteDomain, ID)
+		}
+		matched++
 	}
 
-	if affected == 0 {
-		return sql.ErrNoRows
+	if err = rows.Err(); err != nil {
+		return nil, nil, spanError(span, err)
 	}
 
-	return nil
+	spanRows(span, matched)
+
+	return byName, byDomain, nil
 }
 
 func ValidateCompany(v *validator.Validator, company *Company) {
+	v.Struct(company)
+}
+
+// How Delete treats a company's live contacts, quotes and projects.
+const (
+	DependentsBlock    = "block"
+	DependentsCascade  = "cascade"
+	DependentsReassign = "reassign"
+)
+
+// CompanyDependents counts the records that belong to a company and
+// aren't deleted, and its direct subsidiaries.
+type CompanyDependents struct {
+	Contacts     int `json:"contacts"`
+	Quotes       int `json:"quotes"`
+	Projects     int `json:"projects"`
+	Subsidiaries int `json:"subsidiaries"`
+}
 
-	v.Check(company.Name != "", "name", "name is required")
-	v.Check(len(company.Name) <= 255, "name", "name must not exceed 255 characters")
+// Total is the number of dependents.
+func (d CompanyDependents) Total() int {
+	return d.Contacts + d.Quotes + d.Projects + d.Subsidiaries
+}
 
-	v.Check(company.Address != "", "address", "address is required")
-	v.Check(len(company.Address) <= 255, "address", "address must not exceed 255 characters")
+// CompanyDeletion reports what deleting a company did, or with DryRun
+// would do.
+type CompanyDeletion struct {
+	Action       string            `json:"action"`
+	DryRun       bool              `json:"dry_run"`
+	Blocked      bool              `json:"blocked"`
+	Dependents   CompanyDependents `json:"dependents"`
+	ReassignedTo *uuid.UUID        `json:"reassigned_to,omitempty"`
+}
+
+// companyDependents are the tables whose rows belong to a company.
+var companyDependents = []string{"contacts", "quotes", "projects"}
+
+// Delete soft-deletes a company, dealing with its dependents
+// according to action: DependentsBlock refuses with ErrHasDependents if
+// there are any, DependentsCascade soft-deletes them too, and
+// DependentsReassign moves them to the company reassignTo first, which
+// must exist or ErrInvalidUUID is returned. Subsidiaries are companies in
+// their own right, so unless blocked they move up to the company's parent
+// rather than being deleted or reassigned. Everything happens in one
+// transaction, rolled back when dryRun is set so the result shows the
+// impact. The deletion is recorded in the audit log as done by actor.
+func (c CompanyModel) Delete(ctx context.Context, ID uuid.UUID, action string, reassignTo *uuid.UUID, dryRun bool, actor uuid.UUID) (*CompanyDeletion, error) {
+	query := `
+		SELECT
+			(SELECT count(*) FROM contacts WHERE company_id = $1 AND deleted_at IS NULL),
+			(SELECT count(*) FROM quotes WHERE company_id = $1 AND deleted_at IS NULL),
+			(SELECT count(*) FROM projects WHERE company_id = $1 AND deleted_at IS NULL),
+			(SELECT count(*) FROM companies WHERE parent_id = $1 AND deleted_at IS NULL)
+	`
 
-	v.Check(company.CompanySize != "", "company_size", "company_size is required")
-	v.Check(len(company.CompanySize) <= 255, "company_size", "company_size must not exceed 255 characters")
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 
-	v.Check(company.Industry != "", "industry", "industry is required")
-	v.Check(len(company.Industry) <= 255, "industry", "industry must not exceed 255 characters")
+	ctx, span := startSpan(ctx, "CompanyModel.Delete", query)
+	defer span.End()
 
-	v.Check(company.BusinessType != "", "business_type", "business_type is required")
-	v.Check(len(company.BusinessType) <= 255, "business_type", "business_type must not exceed 255 characters")
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer tx.Rollback()
 
-	v.Check(company.Country != "", "country", "country is required")
-	v.Check(len(company.Country) <= 255, "country", "country must not exceed 255 characters")
+	deletion := &CompanyDeletion{Action: action, DryRun: dryRun}
+	dependents := &deletion.Dependents
 
-	v.Check(company.Email != "", "email", "email is required")
+	// Lock the company so no dependents are added while it's deleted.
+	err = tx.QueryRowContext(ctx, `SELECT id FROM companies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, ID).Scan(&ID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
 
-	if !validator.Matches(company.Email, validator.EmailRX) {
-		v.AddError("email", "invalid email")
+	err = tx.QueryRowContext(ctx, query, ID).Scan(&dependents.Contacts, &dependents.Quotes, &dependents.Projects, &dependents.Subsidiaries)
+	if err != nil {
+		return nil, spanError(span, err)
 	}
+
+	switch action {
+	case DependentsBlock:
+		if dependents.Total() > 0 {
+			deletion.Blocked = true
+			if !dryRun {
+				return deletion, ErrHasDependents
+			}
+			return deletion, nil
+		}
+
+	case DependentsCascade:
+		for _, table := range companyDependents {
+			_, err = tx.ExecContext(ctx, `UPDATE `+table+` SET deleted_at = NOW() WHERE company_id = $1 AND deleted_at IS NULL`, ID)
+			if err != nil {
+				return nil, spanError(span, err)
+			}
+		}
+
+	case DependentsReassign:
+		var target uuid.UUID
+		err = tx.QueryRowContext(ctx, `
+			SELECT id FROM companies
+			WHERE id = $1 AND id <> $2 AND deleted_at IS NULL
+			FOR SHARE
+		`, reassignTo, ID).Scan(&target)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrInvalidUUID
+		case err != nil:
+			return nil, spanError(span, err)
+		}
+
+		for _, table := range companyDependents {
+			_, err = tx.ExecContext(ctx, `UPDATE `+table+` SET company_id = $1, updated_at = NOW() WHERE company_id = $2 AND deleted_at IS NULL`, reassignTo, ID)
+			if err != nil {
+				return nil, spanError(span, err)
+			}
+		}
+		deletion.ReassignedTo = reassignTo
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE companies
+		SET parent_id = (SELECT parent_id FROM companies WHERE id = $1),
+		updated_at = NOW()
+		WHERE parent_id = $1
+	`, ID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE companies SET deleted_at = NOW() WHERE id = $1`, ID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	err = insertAudit(ctx, tx, AuditEntry{
+		ActorID:  actor,
+		Action:   AuditCompanyDelete,
+		Entity:   "companies",
+		EntityID: ID,
+		Details:  deletion,
+	})
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	if !dryRun {
+		if err = tx.Commit(); err != nil {
+			return nil, spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1+dependents.Total())
+
+	return deletion, nil
 }
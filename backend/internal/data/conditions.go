@@ -0,0 +1,297 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// Filter operators, written before the value as in ?country=in:PH,SG. A
+// value without a known operator prefix is an equality match.
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpIn       = "in"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpContains = "contains"
+)
+
+var filterOps = []string{OpEq, OpNe, OpIn, OpGt, OpGte, OpLt, OpLte, OpContains}
+
+// IsFilterOp reports whether op is a known filter operator.
+func IsFilterOp(op string) bool {
+	return slices.Contains(filterOps, op)
+}
+
+// FilterKind is the type of a filterable column. It decides how values
+// are parsed and what they are cast to in SQL.
+type FilterKind int
+
+const (
+	KindText FilterKind = iota
+	KindUUID
+	KindTime
+	KindInt
+	KindNumber
+	KindDate
+	KindBool
+)
+
+// FilterField is a column list endpoints may filter on.
+type FilterField struct {
+	Column string
+	Kind   FilterKind
+	Ops    []string
+	// Me allows the value "me", meaning the authenticated user's ID.
+	Me bool
+	// Company marks a company ID that Filters.IncludeSubsidiaries widens.
+	Company bool
+	// Tags matches the names of the tags on the record of this entity
+	// whose ID is Column.
+	Tags string
+}
+
+var (
+	textOps = []string{OpEq, OpNe, OpIn, OpContains}
+	uuidOps = []string{OpEq, OpNe, OpIn}
+	timeOps = []string{OpGt, OpGte, OpLt, OpLte}
+	intOps  = []string{OpEq, OpNe, OpIn, OpGt, OpGte, OpLt, OpLte}
+	tagOps  = []string{OpEq, OpNe, OpIn}
+	enumOps = []string{OpEq, OpNe, OpIn}
+	dateOps = []string{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte}
+	boolOps = []string{OpEq, OpNe}
+)
+
+// Condition is a single parsed filter such as country=in:PH,SG.
+type Condition struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+var CompanyFilterFields = map[string]FilterField{
+	"name":          {Column: "c.name", Kind: KindText, Ops: textOps},
+	"email":         {Column: "c.email", Kind: KindText, Ops: textOps},
+	"industry":      {Column: "c.industry", Kind: KindText, Ops: textOps},
+	"country":       {Column: "c.country", Kind: KindText, Ops: textOps},
+	"company_size":  {Column: "c.company_size", Kind: KindText, Ops: textOps},
+	"business_type": {Column: "c.business_type", Kind: KindText, Ops: textOps},
+	"sales_owner":   {Column: "c.sales_owner", Kind: KindUUID, Ops: uuidOps, Me: true},
+	"parent_id":     {Column: "c.parent_id", Kind: KindUUID, Ops: uuidOps},
+	"tags":          {Column: "c.id", Kind: KindText, Ops: tagOps, Tags: "companies"},
+	"created_at":    {Column: "c.created_at", Kind: KindTime, Ops: timeOps},
+	"updated_at":    {Column: "c.updated_at", Kind: KindTime, Ops: timeOps},
+}
+
+var ContactFilterFields = map[string]FilterField{
+	"name":         {Column: "c.name", Kind: KindText, Ops: textOps},
+	"email":        {Column: "c.email", Kind: KindText, Ops: textOps},
+	"title":        {Column: "c.title", Kind: KindText, Ops: textOps},
+	"status":       {Column: "c.status", Kind: KindText, Ops: textOps},
+	"company_id":   {Column: "c.company_id", Kind: KindUUID, Ops: uuidOps, Company: true},
+	"company_name": {Column: "o.name", Kind: KindText, Ops: textOps},
+	"tags":         {Column: "c.id", Kind: KindText, Ops: tagOps, Tags: "contacts"},
+	"created_at":   {Column: "c.created_at", Kind: KindTime, Ops: timeOps},
+	"updated_at":   {Column: "c.updated_at", Kind: KindTime, Ops: timeOps},
+}
+
+var QuoteFilterFields = map[string]FilterField{
+	"name":         {Column: "q.name", Kind: KindText, Ops: textOps},
+	"stage":        {Column: "q.stage", Kind: KindText, Ops: textOps},
+	"company_id":   {Column: "q.company_id", Kind: KindUUID, Ops: uuidOps, Company: true},
+	"prepared_by":  {Column: "q.prepared_by", Kind: KindUUID, Ops: uuidOps, Me: true},
+	"prepared_for": {Column: "q.prepared_for", Kind: KindUUID, Ops: uuidOps},
+	"sales_tax":    {Column: "q.sales_tax", Kind: KindInt, Ops: intOps},
+	"tags":         {Column: "q.id", Kind: KindText, Ops: tagOps, Tags: "quotes"},
+	"created_at":   {Column: "q.created_at", Kind: KindTime, Ops: timeOps},
+	"updated_at":   {Column: "q.updated_at", Kind: KindTime, Ops: timeOps},
+}
+
+// ParseCondition splits a raw query value such as "gte:2026-01-01" into
+// its operator and values.
+func ParseCondition(field, raw string) Condition {
+	op, value, found := strings.Cut(raw, ":")
+	if !found || !IsFilterOp(op) {
+		op, value = OpEq, raw
+	}
+
+	values := []string{value}
+	if op == OpIn {
+		values = strings.Split(value, ",")
+	}
+
+	return Condition{Field: field, Op: op, Values: values}
+}
+
+func validateConditions(v *validator.Validator, f Filters) {
+	for _, c := range f.Conditions {
+		field, ok := f.FilterSafeList[c.Field]
+		if !ok {
+			v.AddError(c.Field, "is not filterable")
+			continue
+		}
+
+		if !slices.Contains(field.Ops, c.Op) {
+			v.AddError(c.Field, fmt.Sprintf("operator %s is not supported; use one of: %s", c.Op, strings.Join(field.Ops, ", ")))
+			continue
+		}
+
+		v.Check(len(c.Values) <= 100, c.Field, "must not list more than 100 values")
+
+		for _, value := range c.Values {
+			if _, err := field.Kind.parse(value); err != nil {
+				v.AddError(c.Field, err.Error())
+				break
+			}
+		}
+	}
+}
+
+func (k FilterKind) parse(value string) (any, error) {
+	switch k {
+	case KindUUID:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a valid ID")
+		}
+		return id.String(), nil
+	case KindTime:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+		return t, nil
+	case KindInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a whole number")
+		}
+		return n, nil
+	case KindNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case KindDate:
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+		return t.Format(time.DateOnly), nil
+	case KindBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	default:
+		if value == "" {
+			return nil, fmt.Errorf("must not be empty")
+		}
+		return value, nil
+	}
+}
+
+func (k FilterKind) sqlType() string {
+	switch k {
+	case KindUUID:
+		return "uuid"
+	case KindTime:
+		return "timestamptz"
+	case KindInt:
+		return "bigint"
+	case KindNumber:
+		return "numeric"
+	case KindDate:
+		return "date"
+	case KindBool:
+		return "boolean"
+	default:
+		return "text"
+	}
+}
+
+// where returns the conditions as a SQL boolean expression ("TRUE" when
+// there are none) with every value bound as a parameter appended to args.
+// Conditions must have passed ValidateFilters.
+func (f Filters) where(args []any) (string, []any) {
+	var clauses []string
+
+	for _, c := range f.Conditions {
+		field := f.FilterSafeList[c.Field]
+		cast := field.Kind.sqlType()
+
+		if field.Tags != "" {
+			names := make([]string, len(c.Values))
+			for i, value := range c.Values {
+				names[i] = strings.ToLower(value)
+			}
+			args = append(args, pq.Array(names))
+
+			clause := taggedWith(field.Tags, field.Column, fmt.Sprintf("$%d", len(args)))
+			if c.Op == OpNe {
+				clause = "NOT " + clause
+			}
+			clauses = append(clauses, clause)
+			continue
+		}
+
+		if field.Company && f.IncludeSubsidiaries {
+			args = append(args, pq.Array(c.Values))
+			not := ""
+			if c.Op == OpNe {
+				not = "NOT "
+			}
+			clauses = append(clauses, fmt.Sprintf("%s %sIN %s", field.Column, not, companySubtree(fmt.Sprintf("$%d", len(args)))))
+			continue
+		}
+
+		switch c.Op {
+		case OpIn:
+			args = append(args, pq.Array(c.Values))
+			clauses = append(clauses, fmt.Sprintf("%s = ANY($%d::%s[])", field.Column, len(args), cast))
+
+		case OpContains:
+			args = append(args, "%"+escapeLike(c.Values[0])+"%")
+			clauses = append(clauses, fmt.Sprintf("%s ILIKE $%d", field.Column, len(args)))
+
+		default:
+			value, _ := field.Kind.parse(c.Values[0])
+			args = append(args, value)
+			clauses = append(clauses, fmt.Sprintf("%s %s $%d::%s", field.Column, sqlOperators[c.Op], len(args), cast))
+		}
+	}
+
+	if len(clauses) == 0 {
+		return "TRUE", args
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
+
+var sqlOperators = map[string]string{
+	OpEq:  "=",
+	OpNe:  "<>",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
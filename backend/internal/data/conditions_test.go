@@ -0,0 +1,166 @@
+package data
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Condition
+	}{
+		{"PH", Condition{Field: "country", Op: OpEq, Values: []string{"PH"}}},
+		{"eq:PH", Condition{Field: "country", Op: OpEq, Values: []string{"PH"}}},
+		{"ne:PH", Condition{Field: "country", Op: OpNe, Values: []string{"PH"}}},
+		{"in:PH,SG", Condition{Field: "country", Op: OpIn, Values: []string{"PH", "SG"}}},
+		{"in:", Condition{Field: "country", Op: OpIn, Values: []string{""}}},
+		{"contains:a:b", Condition{Field: "country", Op: OpContains, Values: []string{"a:b"}}},
+		{"gte:2026-01-01", Condition{Field: "country", Op: OpGte, Values: []string{"2026-01-01"}}},
+		{"urn:x", Condition{Field: "country", Op: OpEq, Values: []string{"urn:x"}}},
+		{"me", Condition{Field: "country", Op: OpEq, Values: []string{"me"}}},
+		{"", Condition{Field: "country", Op: OpEq, Values: []string{""}}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseCondition("country", tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCondition(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]string
+		want map[string]string
+	}{
+		{"valid", map[string]string{"name": "contains:acme", "sales_tax": "gte:10", "created_at": "lt:2026-01-01"}, map[string]string{}},
+		{"rfc 3339 time", map[string]string{"created_at": "gte:2026-01-01T08:00:00Z"}, map[string]string{}},
+		{"unknown field", map[string]string{"secret": "x"}, map[string]string{"secret": "is not filterable"}},
+		{"unsupported operator", map[string]string{"created_at": "eq:2026-01-01"}, map[string]string{"created_at": "operator eq is not supported; use one of: gt, gte, lt, lte"}},
+		{"bad id", map[string]string{"company_id": "in:" + "00000000-0000-0000-0000-000000000001,nope"}, map[string]string{"company_id": "must be a valid ID"}},
+		{"bad int", map[string]string{"sales_tax": "gt:ten"}, map[string]string{"sales_tax": "must be a whole number"}},
+		{"bad time", map[string]string{"created_at": "gt:yesterday"}, map[string]string{"created_at": "must be a date (YYYY-MM-DD) or RFC 3339 time"}},
+		{"empty text", map[string]string{"name": ""}, map[string]string{"name": "must not be empty"}},
+		{"unresolved me", map[string]string{"prepared_by": "me"}, map[string]string{"prepared_by": "must be a valid ID"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{FilterSafeList: QuoteFilterFields}
+			for field, raw := range tt.raw {
+				f.Conditions = append(f.Conditions, ParseCondition(field, raw))
+			}
+
+			v := validator.New()
+			validateConditions(v, f)
+
+			if !maps.Equal(v.Errors, tt.want) {
+				t.Errorf("got errors %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		clause    string
+		args      []any
+	}{
+		{
+			name:      "eq",
+			condition: Condition{Field: "stage", Op: OpEq, Values: []string{"Won"}},
+			clause:    "q.stage = $2::text",
+			args:      []any{"Won"},
+		},
+		{
+			name:      "gt int",
+			condition: Condition{Field: "sales_tax", Op: OpGt, Values: []string{"12"}},
+			clause:    "q.sales_tax > $2::bigint",
+			args:      []any{int64(12)},
+		},
+		{
+			name:      "lte date",
+			condition: Condition{Field: "created_at", Op: OpLte, Values: []string{"2026-01-01"}},
+			clause:    "q.created_at <= $2::timestamptz",
+			args:      []any{time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:      "in",
+			condition: Condition{Field: "stage", Op: OpIn, Values: []string{"Won", "Lost"}},
+			clause:    "q.stage = ANY($2::text[])",
+			args:      []any{pq.Array([]string{"Won", "Lost"})},
+		},
+		{
+			name:      "contains escapes wildcards",
+			condition: Condition{Field: "name", Op: OpContains, Values: []string{`50%_off\`}},
+			clause:    "q.name ILIKE $2",
+			args:      []any{`%50\%\_off\\%`},
+		},
+		{
+			name:      "tags are case-insensitive",
+			condition: Condition{Field: "tags", Op: OpNe, Values: []string{"VIP"}},
+			clause:    "NOT " + taggedWith("quotes", "q.id", "$2"),
+			args:      []any{pq.Array([]string{"vip"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{FilterSafeList: QuoteFilterFields, Conditions: []Condition{tt.condition}}
+
+			clause, args := f.where([]any{"first"})
+			if clause != tt.clause {
+				t.Errorf("got clause %q, want %q", clause, tt.clause)
+			}
+
+			want := append([]any{"first"}, tt.args...)
+			if !reflect.DeepEqual(args, want) {
+				t.Errorf("got args %#v, want %#v", args, want)
+			}
+		})
+	}
+
+	f := Filters{FilterSafeList: QuoteFilterFields}
+	if clause, args := f.where(nil); clause != "TRUE" || len(args) != 0 {
+		t.Errorf("no conditions: got %q %v, want TRUE and no args", clause, args)
+	}
+
+	f.Conditions = []Condition{
+		{Field: "stage", Op: OpEq, Values: []string{"Won"}},
+		{Field: "sales_tax", Op: OpLt, Values: []string{"5"}},
+	}
+	if clause, _ := f.where(nil); clause != "q.stage = $1::text AND q.sales_tax < $2::bigint" {
+		t.Errorf("two conditions: got %q", clause)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"acme":     "acme",
+		"100%":     `100\%`,
+		"a_b":      `a\_b`,
+		`C:\temp`:  `C:\\temp`,
+		`\%_`:      `\\\%\_`,
+		"":         "",
+		"Ächmé %":  `Ächmé \%`,
+		"50%_off":  `50\%\_off`,
+		"%%":       `\%\%`,
+		"__init__": `\_\_init\_\_`,
+	}
+
+	for s, want := range tests {
+		if got := escapeLike(s); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
@@ -8,44 +8,35 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/kharljhon14/zentrix/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Contact struct {
-	ID        uuid.UUID  `json:"uuid"`
-	Name      string     `json:"name"`
-	Email     string     `json:"email"`
-	CompanyID *uuid.UUID `json:"company_id"`
-	Title     string     `json:"title"`
-	Status    string     `json:"status"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	ID           uuid.UUID    `json:"uuid"`
+	Name         string       `json:"name" validate:"required,max=255"`
+	Email        string       `json:"email" validate:"required,max=255,email"`
+	CompanyID    *uuid.UUID   `json:"company_id"`
+	Title        string       `json:"title" validate:"required,max=255"`
+	Status       string       `json:"status" validate:"required,max=255"`
+	CustomFields CustomFields `json:"custom_fields"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 func (c Contact) ValidateContact(v *validator.Validator) {
-	v.Check(c.Name != "", "name", "name is required")
-	v.Check(len(c.Name) <= 255, "name", "name must not exceed 255 characters")
-
-	v.Check(c.Email != "", "email", "email is required")
-	if !validator.Matches(c.Email, validator.EmailRX) {
-		v.AddError("email", "invalid email")
-	}
-
-	v.Check(c.Title != "", "title", "title is required")
-	v.Check(len(c.Title) <= 255, "title", "title must not exceed 255 characters")
-	v.Check(c.Status != "", "status", "status is required")
-	v.Check(len(c.Status) <= 255, "status", "status must not exceed 255 characters")
+	v.Struct(c)
 }
 
 type ContactModel struct {
 	DB *sql.DB
 }
 
-func (c ContactModel) Insert(contact *Contact) error {
+func (c ContactModel) Insert(ctx context.Context, contact *Contact) error {
 	query := `
 		INSERT INTO contacts
-		(name, email, company_id, title, status)
+		(name, email, company_id, title, status, custom_fields)
 		VALUES
-		($1, $2, $3, $4, $5)
+		($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -55,11 +46,15 @@ func (c ContactModel) Insert(contact *Contact) error {
 		contact.CompanyID,
 		contact.Title,
 		contact.Status,
+		contact.CustomFields,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ContactModel.Insert", query)
+	defer span.End()
+
 	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
 		&contact.ID,
 		&contact.CreatedAt,
@@ -74,26 +69,93 @@ func (c ContactModel) Insert(contact *Contact) error {
 		case err.Error() == `pq: duplicate key value violates unique constraint "contacts_email_key"`:
 			return ErrDuplicateEmail
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
+	spanRows(span, 1)
+
 	return nil
 }
 
+// Upsert inserts contact or, when its email is taken, updates that contact
+// instead, restoring it if it was deleted. It reports whether a contact was
+// created. A nil CompanyID keeps the existing company.
+func (c ContactModel) Upsert(ctx context.Context, contact *Contact) (bool, error) {
+	query := `
+		INSERT INTO contacts
+		(name, email, company_id, title, status)
+		VALUES
+		($1, $2, $3, $4, $5)
+		ON CONFLICT (email) DO UPDATE
+		SET name = EXCLUDED.name,
+		company_id = COALESCE(EXCLUDED.company_id, contacts.company_id),
+		title = EXCLUDED.title,
+		status = EXCLUDED.status,
+		updated_at = NOW(),
+		deleted_at = NULL
+		RETURNING id, company_id, created_at, updated_at, xmax = 0
+	`
+
+	args := []any{
+		contact.Name,
+		contact.Email,
+		contact.CompanyID,
+		contact.Title,
+		contact.Status,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ContactModel.Upsert", query)
+	defer span.End()
+
+	var created bool
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
+		&contact.ID,
+		&contact.CompanyID,
+		&contact.CreatedAt,
+		&contact.UpdatedAt,
+		&created,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "contacts" violates foreign key constraint "fk_company_id"`:
+			return false, ErrInvalidUUID
+		default:
+			return false, spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return created, nil
+}
+
+// ExistingEmails returns which of emails belong to a contact, deleted or
+// not.
+func (c ContactModel) ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	return existingEmails(ctx, c.DB, "ContactModel.ExistingEmails", "contacts", emails)
+}
+
 type ContactWithCompanyName struct {
-	ID          uuid.UUID  `json:"id"`
-	Name        string     `json:"name"`
-	Email       string     `json:"email"`
-	CompanyID   *uuid.UUID `json:"company_id"`
-	CompanyName *string    `json:"company_name"`
-	Title       string     `json:"title"`
-	Status      string     `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name"`
+	Email        string       `json:"email"`
+	CompanyID    *uuid.UUID   `json:"company_id"`
+	CompanyName  *string      `json:"company_name"`
+	Title        string       `json:"title"`
+	Status       string       `json:"status"`
+	Tags         TagRefs      `json:"tags"`
+	CustomFields CustomFields `json:"custom_fields"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Rank         *float64     `json:"rank,omitempty"`
+	Highlight    *string      `json:"highlight,omitempty"`
 }
 
-func (c ContactModel) GetByID(ID uuid.UUID) (*Contact, error) {
+func (c ContactModel) GetByID(ctx context.Context, ID uuid.UUID) (*Contact, error) {
 	query := `
 		SELECT 
 			id,
@@ -102,15 +164,19 @@ func (c ContactModel) GetByID(ID uuid.UUID) (*Contact, error) {
 			company_id,
 			title,
 			status,
+			custom_fields,
 			created_at,
 			updated_at
 		FROM contacts 
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ContactModel.GetByID", query)
+	defer span.End()
+
 	var contact Contact
 	err := c.DB.QueryRowContext(ctx, query, ID).Scan(
 		&contact.ID,
@@ -119,17 +185,20 @@ func (c ContactModel) GetByID(ID uuid.UUID) (*Contact, error) {
 		&contact.CompanyID,
 		&contact.Title,
 		&contact.Status,
+		&contact.CustomFields,
 		&contact.CreatedAt,
 		&contact.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &contact, nil
 }
 
-func (c ContactModel) GetByIDWithCompanyName(ID uuid.UUID) (*ContactWithCompanyName, error) {
+func (c ContactModel) GetByIDWithCompanyName(ctx context.Context, ID uuid.UUID) (*ContactWithCompanyName, error) {
 	query := `
 		SELECT 
 			c.id,
@@ -139,6 +208,7 @@ func (c ContactModel) GetByIDWithCompanyName(ID uuid.UUID) (*ContactWithCompanyN
 			o.name AS company_name,
 			c.title,
 			c.status,
+			c.custom_fields,
 			c.created_at,
 			c.updated_at
 		FROM contacts c
@@ -147,9 +217,12 @@ func (c ContactModel) GetByIDWithCompanyName(ID uuid.UUID) (*ContactWithCompanyN
 		WHERE c.id = $1 AND c.deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ContactModel.GetByIDWithCompanyName", query)
+	defer span.End()
+
 	var contact ContactWithCompanyName
 	err := c.DB.QueryRowContext(ctx, query, ID).Scan(
 		&contact.ID,
@@ -159,44 +232,43 @@ func (c ContactModel) GetByIDWithCompanyName(ID uuid.UUID) (*ContactWithCompanyN
 		&contact.CompanyName,
 		&contact.Title,
 		&contact.Status,
+		&contact.CustomFields,
 		&contact.CreatedAt,
 		&contact.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &contact, nil
 }
 
-func (c ContactModel) GetAll(filter Filters, companyID *uuid.UUID) ([]*ContactWithCompanyName, Metadata, error) {
-	query := ""
+// listQuery returns the query GetAll and Export run for filters, the FROM
+// clause it selects from and how many of args that clause uses.
+func (c ContactModel) listQuery(filters Filters) (string, string, []any, int, error) {
+	conditions, args := filters.where(nil)
+	match, rank, headline, args := filters.search(contactSearch, args)
+	countArgs := len(args)
 
-	if companyID != nil {
-		query = fmt.Sprintf(`
-		SELECT 
-			count(c.id) over(),
-			c.id,
-			c.name,
-			c.email,
-			o.id AS company_id,
-			o.name AS company_name,
-			c.title,
-			c.status,
-			c.created_at,
-			c.updated_at
+	from := fmt.Sprintf(`
 		FROM contacts c
 		JOIN companies o
 		ON c.company_id = o.id
-		WHERE o.id = '%s' AND c.deleted_at IS NULL
-		ORDER BY %s %s, c.created_at DESC
-		LIMIT $1 OFFSET $2
-		
-	`, *companyID, filter.sortColumn(), filter.sortDirection())
-	} else {
-		query = fmt.Sprintf(`
+		WHERE c.deleted_at IS NULL AND %s AND %s`, conditions, match)
+
+	sortExpr := filters.sortExpr("c", map[string]string{"company_name": "o.name", "relevance": rank})
+
+	after, window, args, err := filters.window(sortExpr, "c.id", args)
+	if err != nil {
+		return "", "", nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
 		SELECT 
-			count(c.id) over(),
+			%s,
+			%s::text,
 			c.id,
 			c.name,
 			c.email,
@@ -204,60 +276,146 @@ func (c ContactModel) GetAll(filter Filters, companyID *uuid.UUID) ([]*ContactWi
 			o.name AS company_name,
 			c.title,
 			c.status,
+			%s,
+			c.custom_fields,
 			c.created_at,
-			c.updated_at
-		FROM contacts c
-		JOIN companies o
-		ON c.company_id = o.id
-		WHERE c.deleted_at IS NULL
-		ORDER BY %s %s, c.created_at DESC
-		LIMIT $1 OFFSET $2
-		
-	`, filter.sortColumn(), filter.sortDirection())
+			c.updated_at,
+			%s,
+			%s
+		%s AND %s
+		%s
+	`, filters.countExpr("c.id"), sortExpr, tagsColumn("contacts", "c.id"), rank, headline, from, after, window)
+
+	return query, from, args, countArgs, nil
+}
+
+func scanContactWithCompanyName(rows *sql.Rows, totalRecords *int, sortValue *string) (*ContactWithCompanyName, error) {
+	var contact ContactWithCompanyName
+
+	err := rows.Scan(
+		totalRecords,
+		sortValue,
+		&contact.ID,
+		&contact.Name,
+		&contact.Email,
+		&contact.CompanyID,
+		&contact.CompanyName,
+		&contact.Title,
+		&contact.Status,
+		&contact.Tags,
+		&contact.CustomFields,
+		&contact.CreatedAt,
+		&contact.UpdatedAt,
+		&contact.Rank,
+		&contact.Highlight,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return &contact, nil
+}
+
+func (c ContactModel) GetAll(ctx context.Context, filters Filters) ([]*ContactWithCompanyName, Metadata, error) {
+	query, from, args, countArgs, err := c.listQuery(filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	args := []any{filter.limit(), filter.offset()}
+	ctx, span := startSpan(ctx, "ContactModel.GetAll", query)
+	defer span.End()
 
 	rows, err := c.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, spanError(span, err)
 	}
 	defer rows.Close()
 
 	totalRecords := 0
 	contacts := []*ContactWithCompanyName{}
+	sortValues := []string{}
 
 	for rows.Next() {
-		var contact ContactWithCompanyName
+		var sortValue string
 
-		err := rows.Scan(
-			&totalRecords,
-			&contact.ID,
-			&contact.Name,
-			&contact.Email,
-			&contact.CompanyID,
-			&contact.CompanyName,
-			&contact.Title,
-			&contact.Status,
-			&contact.CreatedAt,
-			&contact.UpdatedAt,
-		)
+		contact, err := scanContactWithCompanyName(rows, &totalRecords, &sortValue)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, spanError(span, err)
 		}
 
-		contacts = append(contacts, &contact)
+		contacts = append(contacts, contact)
+		sortValues = append(sortValues, sortValue)
 	}
 
-	metadata := calculateMetadata(totalRecords, filter.Page, filter.PageSize)
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	if filters.Keyset && filters.IncludeTotal {
+		err = c.DB.QueryRowContext(ctx, "SELECT count(*) "+from, args[:countArgs]...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+	}
+
+	contacts, metadata := paginate(filters, contacts, sortValues, func(c *ContactWithCompanyName) uuid.UUID { return c.ID }, totalRecords)
+
+	spanRows(span, len(contacts))
 
 	return contacts, metadata, nil
 }
 
-func (c ContactModel) Update(contact *Contact) error {
+// Export calls fn with every contact matching filters, in order, as rows
+// are read from the database. Paging is ignored.
+func (c ContactModel) Export(ctx context.Context, filters Filters, fn func(*ContactWithCompanyName) error) error {
+	filters.unpaged = true
+
+	query, _, args, _, err := c.listQuery(filters)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ContactModel.Export", query)
+	defer span.End()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer rows.Close()
+
+	var totalRecords, exported int
+	var sortValue string
+
+	for rows.Next() {
+		contact, err := scanContactWithCompanyName(rows, &totalRecords, &sortValue)
+		if err != nil {
+			return spanError(span, err)
+		}
+
+		err = fn(contact)
+		if err != nil {
+			return spanError(span, err)
+		}
+		exported++
+	}
+
+	if err = rows.Err(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, exported)
+
+	return nil
+}
+
+func (c ContactModel) Update(ctx context.Context, contact *Contact) error {
 	query := `
 		UPDATE contacts
 			SET name = $1,
@@ -265,6 +423,7 @@ func (c ContactModel) Update(contact *Contact) error {
 			company_id = $3,
 			title = $4,
 			status = $5,
+			custom_fields = $7,
 			updated_at = NOW()
 		WHERE id = $6 AND deleted_at IS NULL
 		RETURNING updated_at
@@ -277,11 +436,15 @@ func (c ContactModel) Update(contact *Contact) error {
 		contact.Title,
 		contact.Status,
 		contact.ID,
+		contact.CustomFields,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ContactModel.Update", query)
+	defer span.End()
+
 	err := c.DB.QueryRowContext(ctx, query, args...).Scan(
 		&contact.UpdatedAt,
 	)
@@ -292,36 +455,285 @@ func (c ContactModel) Update(contact *Contact) error {
 		case err.Error() == `pq: duplicate key value violates unique constraint "contacts_email_key"`:
 			return ErrDuplicateEmail
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
+	spanRows(span, 1)
+
 	return nil
 }
 
-func (c ContactModel) Delete(ID uuid.UUID) error {
+func (c ContactModel) Delete(ctx context.Context, ID uuid.UUID) error {
 	query := `
 		UPDATE contacts
 			SET deleted_at = NOW()
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ContactModel.Delete", query)
+	defer span.End()
+
 	rows, err := c.DB.ExecContext(ctx, query, ID)
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
 	affected, err := rows.RowsAffected()
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
+	spanRows(span, int(affected))
+
 	if affected == 0 {
 		return sql.ErrNoRows
 	}
 
 	return nil
 }
+
+// ContactMergeFields are the fields a merge can take from any of the
+// contacts. Email is not among them, as the duplicates keep theirs when
+// they are soft-deleted.
+var ContactMergeFields = []string{"name", "company_id", "title", "status"}
+
+// contactReferences are the columns that refer to a contact, which a merge
+// points at the survivor.
+var contactReferences = []struct{ table, column string }{
+	{"quotes", "prepared_for"},
+}
+
+// ContactMerge reports what a merge moved to the surviving contact.
+// References counts the rows pointed at the survivor, by table, with the
+// records whose reference custom fields were re-pointed under
+// "custom_fields".
+type ContactMerge struct {
+	MergedIDs  []uuid.UUID          `json:"merged_ids"`
+	Winners    map[string]uuid.UUID `json:"winners"`
+	References map[string]int       `json:"references"`
+	Preview    bool                 `json:"preview"`
+}
+
+// Merge folds the contacts duplicateIDs into survivorID in one transaction.
+// winners maps fields of ContactMergeFields to the contact whose value the
+// survivor takes; other fields keep the survivor's. Custom fields the
+// survivor has no value for take the first duplicate's that has one.
+// References to the duplicates, including reference custom fields, are
+// pointed at the survivor, the duplicates are soft-deleted and the merge
+// is recorded in the audit log as done by actor.
+//
+// With preview set the transaction is rolled back, so the result shows
+// what the merge would do. When owner is set, every contact must belong to
+// a company that user is the sales owner of, or ErrNotPermitted is
+// returned. sql.ErrNoRows is returned if any contact is missing or deleted.
+func (c ContactModel) Merge(ctx context.Context, survivorID uuid.UUID, duplicateIDs []uuid.UUID, winners map[string]uuid.UUID, owner *uuid.UUID, actor uuid.UUID, preview bool) (*Contact, *ContactMerge, error) {
+	query := `
+		SELECT
+			c.id, c.name, c.email, c.company_id, c.title, c.status,
+			c.custom_fields, c.created_at, c.updated_at, o.sales_owner
+		FROM contacts c
+		LEFT JOIN companies o ON o.id = c.company_id
+		WHERE c.id = ANY($1) AND c.deleted_at IS NULL
+		ORDER BY c.id
+		FOR UPDATE OF c
+	`
+
+	IDs := []string{survivorID.String()}
+	for _, ID := range duplicateIDs {
+		IDs = append(IDs, ID.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ContactModel.Merge", query)
+	defer span.End()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(IDs))
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	contacts := make(map[uuid.UUID]*Contact, len(IDs))
+	permitted := true
+
+	for rows.Next() {
+		var contact Contact
+		var salesOwner *uuid.UUID
+
+		err := rows.Scan(
+			&contact.ID,
+			&contact.Name,
+			&contact.Email,
+			&contact.CompanyID,
+			&contact.Title,
+			&contact.Status,
+			&contact.CustomFields,
+			&contact.CreatedAt,
+			&contact.UpdatedAt,
+			&salesOwner,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, nil, spanError(span, err)
+		}
+
+		if owner != nil && (salesOwner == nil || *salesOwner != *owner) {
+			permitted = false
+		}
+
+		contacts[contact.ID] = &contact
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	if len(contacts) != len(IDs) {
+		return nil, nil, spanError(span, sql.ErrNoRows)
+	}
+
+	if !permitted {
+		return nil, nil, ErrNotPermitted
+	}
+
+	survivor := contacts[survivorID]
+	before := *survivor
+
+	for field, ID := range winners {
+		winner := contacts[ID]
+		if winner == nil {
+			return nil, nil, spanError(span, sql.ErrNoRows)
+		}
+
+		switch field {
+		case "name":
+			survivor.Name = winner.Name
+		case "company_id":
+			survivor.CompanyID = winner.CompanyID
+		case "title":
+			survivor.Title = winner.Title
+		case "status":
+			survivor.Status = winner.Status
+		}
+	}
+
+	for _, ID := range duplicateIDs {
+		survivor.CustomFields = survivor.CustomFields.Fill(contacts[ID].CustomFields)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE contacts
+		SET name = $1,
+		company_id = $2,
+		title = $3,
+		status = $4,
+		custom_fields = $5,
+		updated_at = NOW()
+		WHERE id = $6
+		RETURNING updated_at
+	`,
+		survivor.Name,
+		survivor.CompanyID,
+		survivor.Title,
+		survivor.Status,
+		survivor.CustomFields,
+		survivor.ID,
+	).Scan(&survivor.UpdatedAt)
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	merge := &ContactMerge{
+		MergedIDs:  duplicateIDs,
+		Winners:    winners,
+		References: make(map[string]int, len(contactReferences)),
+		Preview:    preview,
+	}
+	if merge.Winners == nil {
+		merge.Winners = map[string]uuid.UUID{}
+	}
+
+	for _, ref := range contactReferences {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE `+ref.table+` SET `+ref.column+` = $1, updated_at = NOW() WHERE `+ref.column+` = ANY($2)`,
+			survivorID, pq.Array(IDs[1:]))
+		if err != nil {
+			return nil, nil, spanError(span, err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, nil, spanError(span, err)
+		}
+
+		merge.References[ref.table] += int(n)
+	}
+
+	n, err := repointReferences(ctx, tx, "contacts", duplicateIDs, &survivorID)
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+	merge.References["custom_fields"] = n
+
+	// The survivor may itself have referred to a duplicate.
+	if n > 0 {
+		err = tx.QueryRowContext(ctx, `SELECT custom_fields, updated_at FROM contacts WHERE id = $1`, survivorID).
+			Scan(&survivor.CustomFields, &survivor.UpdatedAt)
+		if err != nil {
+			return nil, nil, spanError(span, err)
+		}
+	}
+
+	err = copyTags(ctx, tx, "contacts", survivorID, duplicateIDs)
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE contacts SET deleted_at = NOW() WHERE id = ANY($1)`, pq.Array(IDs[1:]))
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	merged := make([]*Contact, len(duplicateIDs))
+	for i, ID := range duplicateIDs {
+		merged[i] = contacts[ID]
+	}
+
+	err = insertAudit(ctx, tx, AuditEntry{
+		ActorID:  actor,
+		Action:   AuditContactMerge,
+		Entity:   "contacts",
+		EntityID: survivorID,
+		Details: struct {
+			*ContactMerge
+			Before *Contact   `json:"before"`
+			Merged []*Contact `json:"merged"`
+		}{merge, &before, merged},
+	})
+	if err != nil {
+		return nil, nil, spanError(span, err)
+	}
+
+	// A preview leaves the deferred rollback to undo the merge.
+	if !preview {
+		if err = tx.Commit(); err != nil {
+			return nil, nil, spanError(span, err)
+		}
+	}
+
+	spanRows(span, len(contacts))
+
+	return survivor, merge, nil
+}
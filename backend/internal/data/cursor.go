@@ -0,0 +1,140 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// exportTimeout bounds Export queries, which read whole tables and so get
+// longer than the usual three seconds.
+const exportTimeout = 5 * time.Minute
+
+// cursor marks the last row of a keyset page. It is handed to clients as
+// an opaque base64 string, so its layout can change without notice.
+type cursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func (c cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return c, err
+	}
+
+	if c.ID == uuid.Nil {
+		return c, fmt.Errorf("cursor has no id")
+	}
+
+	return c, nil
+}
+
+// sortExpr returns the SQL expression for the sort column. Columns are
+// qualified with alias unless columns maps them to something else, e.g.
+// company_name to o.name, or they are custom fields.
+func (f Filters) sortExpr(alias string, columns map[string]string) string {
+	column := f.sortColumn()
+	if expr, ok := columns[column]; ok {
+		return expr
+	}
+	if expr, ok := f.customSorts[column]; ok {
+		return expr
+	}
+
+	return alias + "." + column
+}
+
+// countExpr returns the select expression holding the total row count. In
+// keyset mode the window count would only cover the rows after the cursor,
+// so it is left out and counted separately when asked for.
+func (f Filters) countExpr(idExpr string) string {
+	if f.Keyset || f.unpaged {
+		return "0"
+	}
+
+	return fmt.Sprintf("count(%s) over()", idExpr)
+}
+
+// window returns a condition restricting rows to those after the cursor
+// ("TRUE" when there is none) and the ORDER BY/LIMIT clause, along with
+// args extended by their parameters. Rows are ordered by the sort column
+// and then idExpr so that every row has a unique position. Keyset queries
+// fetch one extra row to learn whether another page follows. Unpaged
+// queries are only ordered.
+func (f Filters) window(sortExpr, idExpr string, args []any) (string, string, []any, error) {
+	direction := f.sortDirection()
+	order := fmt.Sprintf("ORDER BY %s %s, %s %s", sortExpr, direction, idExpr, direction)
+
+	if f.unpaged {
+		return "TRUE", order, args, nil
+	}
+
+	if !f.Keyset {
+		args = append(args, f.limit(), f.offset())
+		return "TRUE", fmt.Sprintf("%s LIMIT $%d OFFSET $%d", order, len(args)-1, len(args)), args, nil
+	}
+
+	condition := "TRUE"
+	if f.After != "" {
+		c, err := decodeCursor(f.After)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		op := ">"
+		if direction == "DESC" {
+			op = "<"
+		}
+
+		args = append(args, c.Value, c.ID)
+		condition = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", sortExpr, idExpr, op, len(args)-1, len(args))
+	}
+
+	args = append(args, f.limit()+1)
+
+	return condition, fmt.Sprintf("%s LIMIT $%d", order, len(args)), args, nil
+}
+
+// paginate trims the look-ahead row from a keyset page and builds the
+// metadata for either paging mode. sortValues holds each row's sort column
+// as text, as selected alongside it.
+func paginate[T any](f Filters, rows []T, sortValues []string, id func(T) uuid.UUID, totalRecords int) ([]T, Metadata) {
+	if !f.Keyset {
+		return rows, calculateMetadata(totalRecords, f.Page, f.PageSize)
+	}
+
+	metadata := Metadata{Limit: f.PageSize}
+	if f.IncludeTotal {
+		metadata.TotalRecords = totalRecords
+	}
+
+	if len(rows) > f.PageSize {
+		rows = rows[:f.PageSize]
+
+		last := len(rows) - 1
+		metadata.NextCursor = cursor{
+			Sort:  f.Sort,
+			Value: sortValues[last],
+			ID:    id(rows[last]),
+		}.encode()
+	}
+
+	return rows, metadata
+}
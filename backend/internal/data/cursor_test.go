@@ -0,0 +1,129 @@
+package data
+
+import (
+	"encoding/base64"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	valid := cursor{Sort: "-created_at", Value: "2026-10-18T00:00:00Z", ID: uuid.New()}
+
+	got, err := decodeCursor(valid.encode())
+	if err != nil {
+		t.Fatalf("decoding an encoded cursor: %v", err)
+	}
+	if got != valid {
+		t.Errorf("got %+v, want %+v", got, valid)
+	}
+
+	encoded := valid.encode()
+	tampered := encoded[:len(encoded)-4] + "!!!!"
+
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor"},
+		{"tampered", tampered},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"name","v":"a","id":"` + valid.ID.String() + `"}`))},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("not json"))},
+		{"truncated json", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":`))},
+		{"bad id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":"a","id":"123"}`))},
+		{"no id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":"a"}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.s); err == nil {
+				t.Errorf("decodeCursor(%q) succeeded, want an error", tt.s)
+			}
+		})
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	byName := cursor{Sort: "name", Value: "Acme", ID: uuid.New()}.encode()
+
+	tests := []struct {
+		name  string
+		sort  string
+		after string
+		want  map[string]string
+	}{
+		{"first page", "name", "", map[string]string{}},
+		{"matching sort", "name", byName, map[string]string{}},
+		{"sort mismatch", "-name", byName, map[string]string{"after": "cursor was issued for a different sort"}},
+		{"invalid", "name", "garbage", map[string]string{"after": "invalid cursor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{
+				Page:         1,
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafeList: []string{"name", "-name"},
+				Keyset:       true,
+				After:        tt.after,
+			}
+
+			v := validator.New()
+			ValidateFilters(v, f)
+
+			if !maps.Equal(v.Errors, tt.want) {
+				t.Errorf("got errors %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowAfterCursor(t *testing.T) {
+	ID := uuid.New()
+
+	tests := []struct {
+		sort string
+		op   string
+	}{
+		{"name", ">"},
+		{"-name", "<"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			f := Filters{
+				PageSize:     20,
+				Sort:         tt.sort,
+				SortSafeList: []string{"name", "-name"},
+				Keyset:       true,
+				After:        cursor{Sort: tt.sort, Value: "Acme", ID: ID}.encode(),
+			}
+
+			condition, order, args, err := f.window("c.name", "c.id", []any{"x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "(c.name, c.id) " + tt.op + " ($2, $3)"; condition != want {
+				t.Errorf("got condition %q, want %q", condition, want)
+			}
+			if !strings.HasSuffix(order, "LIMIT $4") {
+				t.Errorf("got order %q, want it to end in LIMIT $4", order)
+			}
+			if len(args) != 4 || args[1] != "Acme" || args[2] != ID || args[3] != 21 {
+				t.Errorf("got args %v, want [x Acme %s 21]", args, ID)
+			}
+		})
+	}
+
+	f := Filters{PageSize: 20, Sort: "name", SortSafeList: []string{"name"}, Keyset: true, After: "garbage"}
+	if _, _, _, err := f.window("c.name", "c.id", nil); err == nil {
+		t.Error("window accepted an invalid cursor")
+	}
+}
@@ -0,0 +1,588 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// Custom field types.
+const (
+	FieldText      = "text"
+	FieldNumber    = "number"
+	FieldDate      = "date"
+	FieldEnum      = "enum"
+	FieldBoolean   = "boolean"
+	FieldReference = "reference"
+)
+
+var CustomFieldTypes = []string{FieldText, FieldNumber, FieldDate, FieldEnum, FieldBoolean, FieldReference}
+
+// CustomFieldEntities are the entity types custom fields can be defined on.
+var CustomFieldEntities = []string{"companies", "contacts", "quotes"}
+
+// ReferenceEntities are the entity types a reference field can point at.
+var ReferenceEntities = []string{"companies", "contacts", "quotes", "projects", "users"}
+
+var CustomFieldKeyRX = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// maxCustomText bounds the length of text custom field values.
+const maxCustomText = 1000
+
+// CustomField defines an extra field on the records of Entity. Values are
+// stored in the records' custom_fields column under Key, which together
+// with Entity and Type can't change once the field is created.
+type CustomField struct {
+	ID     uuid.UUID `json:"id"`
+	Entity string    `json:"entity"`
+	Key    string    `json:"key" validate:"required,max=50"`
+	Label  string    `json:"label" validate:"required,max=255"`
+	Type   string    `json:"type"`
+	// Options are the choices of an enum field.
+	Options []string `json:"options,omitempty"`
+	// Reference is the entity a reference field points at.
+	Reference string    `json:"reference,omitempty"`
+	Required  bool      `json:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateCustomField(v *validator.Validator, field *CustomField) {
+	v.Struct(field)
+	v.Check(validator.PermittedValues(field.Entity, CustomFieldEntities...), "entity", "must be one of: "+strings.Join(CustomFieldEntities, ", "))
+	v.Check(validator.Matches(field.Key, CustomFieldKeyRX), "key", "must start with a lowercase letter and contain only lowercase letters, digits and underscores")
+	v.Check(validator.PermittedValues(field.Type, CustomFieldTypes...), "type", "must be one of: "+strings.Join(CustomFieldTypes, ", "))
+
+	if field.Type == FieldEnum {
+		v.Check(len(field.Options) > 0, "options", "must contain at least one option")
+		v.Check(len(field.Options) <= 100, "options", "must not contain more than 100 options")
+		for _, option := range field.Options {
+			v.Check(option != "", "options", "must not contain empty options")
+			v.Check(utf8.RuneCountInString(option) <= 255, "options", "must not contain options longer than 255 characters")
+			// Commas separate the values of ?custom_fields.<key>=in:.
+			v.Check(!strings.Contains(option, ","), "options", "must not contain commas")
+		}
+		v.Check(len(slices.Compact(slices.Sorted(slices.Values(field.Options)))) == len(field.Options), "options", "must not contain duplicate options")
+	} else {
+		v.Check(len(field.Options) == 0, "options", "must only be given for enum fields")
+	}
+
+	if field.Type == FieldReference {
+		v.Check(validator.PermittedValues(field.Reference, ReferenceEntities...), "reference", "must be one of: "+strings.Join(ReferenceEntities, ", "))
+	} else {
+		v.Check(field.Reference == "", "reference", "must only be given for reference fields")
+	}
+}
+
+// filterField returns how list endpoints filter on the field, reading it
+// from the custom_fields column of the table aliased alias.
+func (f *CustomField) filterField(alias string) FilterField {
+	value := fmt.Sprintf("%s.custom_fields->>'%s'", alias, f.Key)
+
+	switch f.Type {
+	case FieldNumber:
+		return FilterField{Column: fmt.Sprintf("(%s)::numeric", value), Kind: KindNumber, Ops: intOps}
+	case FieldDate:
+		return FilterField{Column: fmt.Sprintf("(%s)::date", value), Kind: KindDate, Ops: dateOps}
+	case FieldBoolean:
+		return FilterField{Column: fmt.Sprintf("(%s)::boolean", value), Kind: KindBool, Ops: boolOps}
+	case FieldReference:
+		return FilterField{Column: fmt.Sprintf("(%s)::uuid", value), Kind: KindUUID, Ops: uuidOps}
+	case FieldEnum:
+		return FilterField{Column: fmt.Sprintf("(%s)", value), Kind: KindText, Ops: enumOps}
+	default:
+		return FilterField{Column: fmt.Sprintf("(%s)", value), Kind: KindText, Ops: textOps}
+	}
+}
+
+// sortExpr returns the field as a sort expression, reading it from the
+// custom_fields column of the table aliased alias. Records without a
+// value sort as the lowest, so that keyset cursors never hold NULL.
+func (f *CustomField) sortExpr(alias string) string {
+	value := fmt.Sprintf("%s.custom_fields->>'%s'", alias, f.Key)
+
+	switch f.Type {
+	case FieldNumber:
+		return fmt.Sprintf("COALESCE((%s)::float8, '-Infinity')", value)
+	case FieldDate:
+		return fmt.Sprintf("COALESCE((%s)::date, '-infinity')", value)
+	case FieldBoolean:
+		return fmt.Sprintf("COALESCE((%s)::boolean, false)", value)
+	default:
+		return fmt.Sprintf("COALESCE(%s, '')", value)
+	}
+}
+
+// parse checks that value suits the field and returns it as stored:
+// numbers as float64, dates as YYYY-MM-DD and references as lowercase IDs.
+func (f *CustomField) parse(value any) (any, error) {
+	switch f.Type {
+	case FieldNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case json.Number:
+			return n.Float64()
+		}
+		return nil, fmt.Errorf("must be a number")
+
+	case FieldBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("must be true or false")
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be a string")
+	}
+
+	switch f.Type {
+	case FieldDate:
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			return nil, fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+		return t.Format(time.DateOnly), nil
+
+	case FieldEnum:
+		if !slices.Contains(f.Options, s) {
+			return nil, fmt.Errorf("must be one of: %s", strings.Join(f.Options, ", "))
+		}
+		return s, nil
+
+	case FieldReference:
+		ID, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("must be a valid ID")
+		}
+		return ID.String(), nil
+
+	default:
+		if s == "" {
+			return nil, fmt.Errorf("must not be empty; send null to clear it")
+		}
+		if utf8.RuneCountInString(s) > maxCustomText {
+			return nil, fmt.Errorf("must not be more than %d characters long", maxCustomText)
+		}
+		return s, nil
+	}
+}
+
+// CustomFields holds a record's custom field values by key, as stored in
+// its custom_fields column.
+type CustomFields map[string]any
+
+func (c CustomFields) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(c)
+}
+
+func (c *CustomFields) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into CustomFields", src)
+	}
+
+	*c = CustomFields{}
+
+	return json.Unmarshal(b, c)
+}
+
+// Apply sets the values in patch, removing those that are nil.
+func (c CustomFields) Apply(patch map[string]any) {
+	for key, value := range patch {
+		if value == nil {
+			delete(c, key)
+			continue
+		}
+		c[key] = value
+	}
+}
+
+// Fill returns a copy of c that also has the values of from for keys c
+// has no value for.
+func (c CustomFields) Fill(from CustomFields) CustomFields {
+	filled := maps.Clone(c)
+	if filled == nil {
+		filled = CustomFields{}
+	}
+
+	for key, value := range from {
+		if _, ok := filled[key]; !ok {
+			filled[key] = value
+		}
+	}
+
+	return filled
+}
+
+// ValidateCustomFields checks values against the definitions of their
+// entity's custom fields, converting them in place to how they are stored.
+// Errors are keyed custom_fields.<key>.
+func ValidateCustomFields(v *validator.Validator, fields []*CustomField, values CustomFields) {
+	defined := make(map[string]*CustomField, len(fields))
+	for _, field := range fields {
+		defined[field.Key] = field
+
+		_, ok := values[field.Key]
+		v.Check(ok || !field.Required, "custom_fields."+field.Key, "is required")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		field, ok := defined[key]
+		if !ok {
+			v.AddError("custom_fields."+key, "is not a custom field")
+			continue
+		}
+
+		value, err := field.parse(values[key])
+		if err != nil {
+			v.AddError("custom_fields."+key, err.Error())
+			continue
+		}
+		values[key] = value
+	}
+}
+
+// AddCustomFields makes the custom fields of the list's entity filterable
+// and sortable as custom_fields.<key>, reading them from the custom_fields
+// column of the table aliased alias. It must be called after
+// FilterSafeList and SortSafeList are set.
+func (f *Filters) AddCustomFields(alias string, fields []*CustomField) {
+	if len(fields) == 0 {
+		return
+	}
+
+	f.FilterSafeList = maps.Clone(f.FilterSafeList)
+	f.customSorts = make(map[string]string, len(fields))
+
+	for _, field := range fields {
+		name := "custom_fields." + field.Key
+
+		f.FilterSafeList[name] = field.filterField(alias)
+		f.SortSafeList = append(f.SortSafeList, name, "-"+name)
+		f.customSorts[name] = field.sortExpr(alias)
+	}
+}
+
+type CustomFieldModel struct {
+	DB *sql.DB
+}
+
+func (m CustomFieldModel) Insert(ctx context.Context, field *CustomField) error {
+	query := `
+		INSERT INTO custom_fields
+		(entity, key, label, type, options, reference, required)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	args := []any{
+		field.Entity,
+		field.Key,
+		field.Label,
+		field.Type,
+		pq.Array(field.Options),
+		field.Reference,
+		field.Required,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.Insert", query)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&field.ID, &field.CreatedAt, &field.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "custom_fields_entity_key_key"`:
+			return ErrDuplicateKey
+		default:
+			return spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+func (m CustomFieldModel) GetByID(ctx context.Context, ID uuid.UUID) (*CustomField, error) {
+	query := `
+		SELECT id, entity, key, label, type, options, reference, required, created_at, updated_at
+		FROM custom_fields
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.GetByID", query)
+	defer span.End()
+
+	var field CustomField
+	err := m.DB.QueryRowContext(ctx, query, ID).Scan(
+		&field.ID,
+		&field.Entity,
+		&field.Key,
+		&field.Label,
+		&field.Type,
+		pq.Array(&field.Options),
+		&field.Reference,
+		&field.Required,
+		&field.CreatedAt,
+		&field.UpdatedAt,
+	)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return &field, nil
+}
+
+// GetAll returns the custom fields of entity, or of every entity if it is
+// empty, ordered by entity and label.
+func (m CustomFieldModel) GetAll(ctx context.Context, entity string) ([]*CustomField, error) {
+	query := `
+		SELECT id, entity, key, label, type, options, reference, required, created_at, updated_at
+		FROM custom_fields
+		WHERE entity = $1 OR $1 = ''
+		ORDER BY entity, lower(label), key
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.GetAll", query)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query, entity)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer rows.Close()
+
+	fields := []*CustomField{}
+
+	for rows.Next() {
+		var field CustomField
+
+		err := rows.Scan(
+			&field.ID,
+			&field.Entity,
+			&field.Key,
+			&field.Label,
+			&field.Type,
+			pq.Array(&field.Options),
+			&field.Reference,
+			&field.Required,
+			&field.CreatedAt,
+			&field.UpdatedAt,
+		)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		fields = append(fields, &field)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, len(fields))
+
+	return fields, nil
+}
+
+// Update saves the field's label, options and required flag; the rest is
+// fixed when the field is created.
+func (m CustomFieldModel) Update(ctx context.Context, field *CustomField) error {
+	query := `
+		UPDATE custom_fields
+		SET label = $1,
+		options = $2,
+		required = $3,
+		updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.Update", query)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, field.Label, pq.Array(field.Options), field.Required, field.ID).Scan(&field.UpdatedAt)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+// Delete deletes a custom field and its values on every record of its
+// entity, deleted or not, in one transaction.
+func (m CustomFieldModel) Delete(ctx context.Context, ID uuid.UUID) error {
+	query := `DELETE FROM custom_fields WHERE id = $1 RETURNING entity, key`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.Delete", query)
+	defer span.End()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	var entity, key string
+	err = tx.QueryRowContext(ctx, query, ID).Scan(&entity, &key)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	result, err := tx.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET custom_fields = custom_fields - $1 WHERE custom_fields ? $1`, entity),
+		key)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	return nil
+}
+
+// repointReferences points the reference custom fields that refer to the
+// records from of entity at to instead, or removes them when to is nil, as
+// part of tx. It returns how many records changed.
+func repointReferences(ctx context.Context, tx *sql.Tx, entity string, from []uuid.UUID, to *uuid.UUID) (int, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT entity, key FROM custom_fields WHERE type = $1 AND reference = $2`,
+		FieldReference, entity)
+	if err != nil {
+		return 0, err
+	}
+
+	var fields []struct{ entity, key string }
+	for rows.Next() {
+		var field struct{ entity, key string }
+		if err := rows.Scan(&field.entity, &field.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		fields = append(fields, field)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, field := range fields {
+		var result sql.Result
+		if to != nil {
+			result, err = tx.ExecContext(ctx, fmt.Sprintf(`
+				UPDATE %s
+				SET custom_fields = jsonb_set(custom_fields, ARRAY[$1::text], to_jsonb($2::text)),
+				updated_at = NOW()
+				WHERE custom_fields->>$1::text = ANY($3::text[])
+			`, field.entity), field.key, to.String(), pq.Array(from))
+		} else {
+			result, err = tx.ExecContext(ctx, fmt.Sprintf(`
+				UPDATE %s
+				SET custom_fields = custom_fields - $1::text,
+				updated_at = NOW()
+				WHERE custom_fields->>$1::text = ANY($2::text[])
+			`, field.entity), field.key, pq.Array(from))
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		changed += int(n)
+	}
+
+	return changed, nil
+}
+
+// MissingReferences returns the keys of the reference fields among fields
+// whose value in values isn't a record of the referenced entity, or is a
+// deleted one. values must have passed ValidateCustomFields.
+func (m CustomFieldModel) MissingReferences(ctx context.Context, fields []*CustomField, values CustomFields) ([]string, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1%s)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CustomFieldModel.MissingReferences", query)
+	defer span.End()
+
+	missing := []string{}
+
+	for _, field := range fields {
+		value, ok := values[field.Key]
+		if field.Type != FieldReference || !ok {
+			continue
+		}
+
+		live := " AND deleted_at IS NULL"
+		if field.Reference == "users" {
+			live = ""
+		}
+
+		var exists bool
+		err := m.DB.QueryRowContext(ctx, fmt.Sprintf(query, field.Reference, live), value).Scan(&exists)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		if !exists {
+			missing = append(missing, field.Key)
+		}
+	}
+
+	return missing, nil
+}
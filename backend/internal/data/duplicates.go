@@ -0,0 +1,446 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DuplicateThreshold is the lowest score at which two companies are
+// reported as likely duplicates.
+const DuplicateThreshold = 0.5
+
+// detectTimeout bounds a duplicate detection run, which compares every pair
+// of companies.
+const detectTimeout = 5 * time.Minute
+
+// CompanyMergeFields are the fields a merge can take from the duplicate.
+// Email is not among them: it identifies the company, so the survivor is
+// chosen by which email should remain.
+var CompanyMergeFields = []string{
+	"name",
+	"address",
+	"sales_owner",
+	"company_size",
+	"industry",
+	"business_type",
+	"country",
+	"image",
+	"website",
+}
+
+// CompanyRef names a company in a duplicate pair.
+type CompanyRef struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	SalesOwner uuid.UUID `json:"sales_owner"`
+}
+
+// CompanyDuplicate is a pair of companies that are likely the same. Company
+// is the older of the two. Score weighs the similarity of their
+// normalized names, whether their websites share a domain and the
+// similarity of their addresses, from 0 to 1.
+type CompanyDuplicate struct {
+	Company           CompanyRef `json:"company"`
+	Duplicate         CompanyRef `json:"duplicate"`
+	Score             float64    `json:"score"`
+	NameSimilarity    float64    `json:"name_similarity"`
+	SameDomain        bool       `json:"same_domain"`
+	AddressSimilarity float64    `json:"address_similarity"`
+	DetectedAt        time.Time  `json:"detected_at"`
+}
+
+// CompanyMerge reports what a merge moved to the surviving company.
+type CompanyMerge struct {
+	MergedID     uuid.UUID `json:"merged_id"`
+	Fields       []string  `json:"fields"`
+	Contacts     int       `json:"contacts"`
+	Quotes       int       `json:"quotes"`
+	Projects     int       `json:"projects"`
+	Subsidiaries int       `json:"subsidiaries"`
+	// References counts the records whose reference custom fields were
+	// pointed at the survivor.
+	References int `json:"references"`
+}
+
+// DetectDuplicates replaces the stored duplicate pairs with a fresh scan of
+// every company that isn't deleted, and returns how many pairs were found.
+//
+// Names are compared after lower-casing, dropping punctuation and legal
+// suffixes such as "Inc" and "GmbH", so "ACME, Inc." matches "Acme". Only
+// pairs with similar names or the same website domain are scored; the
+// name counts for 60% of the score, the domain 25% and the address 15%.
+func (c CompanyModel) DetectDuplicates(ctx context.Context) (int, error) {
+	query := `
+		WITH normalized AS (
+			SELECT
+				id,
+				created_at,
+				trim(regexp_replace(regexp_replace(
+					regexp_replace(lower(name), '[^[:alnum:]]+', ' ', 'g'),
+					'\m(inc|incorporated|llc|llp|ltd|limited|corp|corporation|co|company|gmbh|plc|sa|sas|ag|bv|nv|pty|srl)\M', ' ', 'g'),
+					'\s+', ' ', 'g')) AS name,
+				substring(lower(website) from '^(?:[a-z]+://)?(?:www\.)?([^/:?#]+)') AS domain,
+				trim(regexp_replace(lower(address), '[^[:alnum:]]+', ' ', 'g')) AS address
+			FROM companies
+			WHERE deleted_at IS NULL
+		), pairs AS (
+			SELECT
+				a.id AS company_id,
+				b.id AS duplicate_id,
+				similarity(a.name, b.name) AS name_similarity,
+				coalesce(a.domain = b.domain, false) AS same_domain,
+				similarity(a.address, b.address) AS address_similarity
+			FROM normalized a
+			JOIN normalized b
+			ON (a.created_at, a.id) < (b.created_at, b.id)
+			AND (a.name % b.name OR a.domain = b.domain)
+		)
+		INSERT INTO company_duplicates
+		(company_id, duplicate_id, score, name_similarity, same_domain, address_similarity)
+		SELECT company_id, duplicate_id, score, name_similarity, same_domain, address_similarity
+		FROM (
+			SELECT *,
+				0.6 * name_similarity +
+				CASE WHEN same_domain THEN 0.25 ELSE 0 END +
+				0.15 * address_similarity AS score
+			FROM pairs
+		) scored
+		WHERE score >= $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.DetectDuplicates", query)
+	defer span.End()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	// Runs replace each other's results, so they take turns.
+	_, err = tx.ExecContext(ctx, `LOCK TABLE company_duplicates IN EXCLUSIVE MODE`)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM company_duplicates`)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, DuplicateThreshold)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+
+	found, err := result.RowsAffected()
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, spanError(span, err)
+	}
+
+	spanRows(span, int(found))
+
+	return int(found), nil
+}
+
+// GetDuplicates returns a page of the pairs found by the last detection
+// run, most likely duplicates first. When owner is set, only pairs of
+// companies that user is the sales owner of both of are returned.
+func (c CompanyModel) GetDuplicates(ctx context.Context, owner *uuid.UUID, minScore float64, filters Filters) ([]*CompanyDuplicate, Metadata, error) {
+	query := `
+		SELECT
+			count(*) OVER(),
+			a.id, a.name, a.sales_owner,
+			b.id, b.name, b.sales_owner,
+			d.score, d.name_similarity, d.same_domain, d.address_similarity, d.detected_at
+		FROM company_duplicates d
+		JOIN companies a ON a.id = d.company_id AND a.deleted_at IS NULL
+		JOIN companies b ON b.id = d.duplicate_id AND b.deleted_at IS NULL
+		WHERE d.score >= $1
+		AND ($2::uuid IS NULL OR (a.sales_owner = $2::uuid AND b.sales_owner = $2::uuid))
+		ORDER BY d.score DESC, a.id, b.id
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.GetDuplicates", query)
+	defer span.End()
+
+	rows, err := c.DB.QueryContext(ctx, query, minScore, owner, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	duplicates := []*CompanyDuplicate{}
+
+	for rows.Next() {
+		var d CompanyDuplicate
+
+		err := rows.Scan(
+			&totalRecords,
+			&d.Company.ID,
+			&d.Company.Name,
+			&d.Company.SalesOwner,
+			&d.Duplicate.ID,
+			&d.Duplicate.Name,
+			&d.Duplicate.SalesOwner,
+			&d.Score,
+			&d.NameSimilarity,
+			&d.SameDomain,
+			&d.AddressSimilarity,
+			&d.DetectedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+
+		duplicates = append(duplicates, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	spanRows(span, len(duplicates))
+
+	return duplicates, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Merge folds the company duplicateID into survivorID in one transaction.
+// The survivor takes the duplicate's values of fields, a subset of
+// CompanyMergeFields, the duplicate's custom field values the survivor has
+// none for, and its contacts, quotes, projects and subsidiaries.
+// Subsidiaries that the survivor itself is below move to the duplicate's
+// parent instead, so no cycle forms, and reference custom fields pointing
+// at the duplicate point at the survivor. The duplicate is then
+// soft-deleted and the merge recorded in the audit log as done by actor.
+// sql.ErrNoRows is returned if either company is missing or deleted, and
+// ErrSelfMerge if they are the same company.
+func (c CompanyModel) Merge(ctx context.Context, survivorID, duplicateID uuid.UUID, fields []string, actor uuid.UUID) (*CompanyMerge, error) {
+	if survivorID == duplicateID {
+		return nil, ErrSelfMerge
+	}
+
+	query := `
+		SELECT
+			id, name, address, sales_owner, email, company_size, business_type,
+			industry, country, image, website, parent_id, custom_fields,
+			created_at, updated_at
+		FROM companies
+		WHERE id IN ($1, $2) AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.Merge", query)
+	defer span.End()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, survivorID, duplicateID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	companies := make(map[uuid.UUID]*Company, 2)
+	for rows.Next() {
+		var company Company
+
+		err := rows.Scan(
+			&company.ID,
+			&company.Name,
+			&company.Address,
+			&company.SalesOwner,
+			&company.Email,
+			&company.CompanySize,
+			&company.BusinessType,
+			&company.Industry,
+			&company.Country,
+			&company.Image,
+			&company.Website,
+			&company.ParentID,
+			&company.CustomFields,
+			&company.CreatedAt,
+			&company.UpdatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, spanError(span, err)
+		}
+
+		companies[company.ID] = &company
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	survivor, duplicate := companies[survivorID], companies[duplicateID]
+	if survivor == nil || duplicate == nil {
+		return nil, spanError(span, sql.ErrNoRows)
+	}
+
+	for _, field := range fields {
+		switch field {
+		case "name":
+			survivor.Name = duplicate.Name
+		case "address":
+			survivor.Address = duplicate.Address
+		case "sales_owner":
+			survivor.SalesOwner = duplicate.SalesOwner
+		case "company_size":
+			survivor.CompanySize = duplicate.CompanySize
+		case "industry":
+			survivor.Industry = duplicate.Industry
+		case "business_type":
+			survivor.BusinessType = duplicate.BusinessType
+		case "country":
+			survivor.Country = duplicate.Country
+		case "image":
+			survivor.Image = duplicate.Image
+		case "website":
+			survivor.Website = duplicate.Website
+		}
+	}
+
+	survivor.CustomFields = survivor.CustomFields.Fill(duplicate.CustomFields)
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE companies
+		SET name = $1,
+		address = $2,
+		sales_owner = $3,
+		company_size = $4,
+		industry = $5,
+		business_type = $6,
+		country = $7,
+		image = $8,
+		website = $9,
+		custom_fields = $10,
+		updated_at = NOW()
+		WHERE id = $11
+	`,
+		survivor.Name,
+		survivor.Address,
+		survivor.SalesOwner,
+		survivor.CompanySize,
+		survivor.Industry,
+		survivor.BusinessType,
+		survivor.Country,
+		survivor.Image,
+		survivor.Website,
+		survivor.CustomFields,
+		survivor.ID,
+	)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	merge := &CompanyMerge{MergedID: duplicateID, Fields: slices.Clone(fields)}
+	if merge.Fields == nil {
+		merge.Fields = []string{}
+	}
+
+	for table, moved := range map[string]*int{
+		"contacts": &merge.Contacts,
+		"quotes":   &merge.Quotes,
+		"projects": &merge.Projects,
+	} {
+		result, err := tx.ExecContext(ctx, `UPDATE `+table+` SET company_id = $1, updated_at = NOW() WHERE company_id = $2`, survivorID, duplicateID)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+		*moved = int(n)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		WITH RECURSIVE above AS (
+			SELECT id, parent_id FROM companies WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id FROM companies c JOIN above a ON c.id = a.parent_id
+		)
+		UPDATE companies
+		SET parent_id = CASE WHEN id IN (SELECT id FROM above) THEN $3::uuid ELSE $1 END,
+		updated_at = NOW()
+		WHERE parent_id = $2
+	`, survivorID, duplicateID, duplicate.ParentID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	merge.Subsidiaries = int(n)
+
+	merge.References, err = repointReferences(ctx, tx, "companies", []uuid.UUID{duplicateID}, &survivorID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	err = copyTags(ctx, tx, "companies", survivorID, []uuid.UUID{duplicateID})
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE companies SET deleted_at = NOW() WHERE id = $1`, duplicateID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM company_duplicates WHERE company_id = $1 OR duplicate_id = $1`, duplicateID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	err = insertAudit(ctx, tx, AuditEntry{
+		ActorID:  actor,
+		Action:   AuditCompanyMerge,
+		Entity:   "companies",
+		EntityID: survivorID,
+		Details: struct {
+			*CompanyMerge
+			Merged *Company `json:"merged"`
+		}{merge, duplicate},
+	})
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 2)
+
+	return merge, nil
+}
@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// productValue is what product p adds to its quote's value: its price
+// times its quantity less the discount, before sales tax.
+const productValue = `p.unit_price::numeric * p.quantity * (100 - COALESCE(p.discount, 0)) / 100`
+
+// CompanyRollup sums a company's figures with those of every company
+// below it.
+type CompanyRollup struct {
+	Subsidiaries int     `json:"subsidiaries"`
+	Contacts     int     `json:"contacts"`
+	QuoteValue   float64 `json:"quote_value"`
+}
+
+// CompanyNode is a company in a hierarchy. Contacts and QuoteValue are the
+// company's own; Rollup adds its subsidiaries'.
+type CompanyNode struct {
+	ID         uuid.UUID      `json:"id"`
+	Name       string         `json:"name"`
+	ParentID   *uuid.UUID     `json:"parent_id"`
+	Depth      int            `json:"depth"`
+	Contacts   int            `json:"contacts"`
+	QuoteValue float64        `json:"quote_value"`
+	Rollup     CompanyRollup  `json:"rollup"`
+	Children   []*CompanyNode `json:"children"`
+}
+
+// rollup fills in the rollups of n and everything below it.
+func (n *CompanyNode) rollup() CompanyRollup {
+	n.Rollup = CompanyRollup{Contacts: n.Contacts, QuoteValue: n.QuoteValue}
+
+	for _, child := range n.Children {
+		below := child.rollup()
+		n.Rollup.Subsidiaries += 1 + below.Subsidiaries
+		n.Rollup.Contacts += below.Contacts
+		n.Rollup.QuoteValue += below.QuoteValue
+	}
+
+	return n.Rollup
+}
+
+// CompanyTree is the hierarchy below a company, with the companies above
+// it from the top down.
+type CompanyTree struct {
+	Ancestors []CompanyRef `json:"ancestors"`
+	Root      *CompanyNode `json:"root"`
+}
+
+// companySubtree is a subquery of the IDs of the companies in the array
+// parameter param and of every company below them.
+func companySubtree(param string) string {
+	return fmt.Sprintf(`(
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM companies WHERE id = ANY(%s::uuid[])
+			UNION
+			SELECT s.id FROM companies s JOIN subtree t ON s.parent_id = t.id
+		)
+		SELECT id FROM subtree
+	)`, param)
+}
+
+// checkParent returns ErrInvalidUUID if parentID isn't a company that
+// isn't deleted, and ErrCompanyCycle if it is ID or below it. It holds a
+// lock until tx ends so that concurrent moves can't close a loop between
+// them.
+func checkParent(ctx context.Context, tx *sql.Tx, ID, parentID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('companies.parent_id'))`)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM companies WHERE id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT c.id, c.parent_id FROM companies c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT count(*), count(*) FILTER (WHERE id = $2) FROM ancestors
+	`
+
+	var found, cycles int
+	err = tx.QueryRowContext(ctx, query, parentID, ID).Scan(&found, &cycles)
+	switch {
+	case err != nil:
+		return err
+	case found == 0:
+		return ErrInvalidUUID
+	case cycles > 0:
+		return ErrCompanyCycle
+	}
+
+	return nil
+}
+
+// GetTree returns the hierarchy below the company ID, with each company's
+// contact count and quote value rolled up, and the companies above it.
+// Deleted companies are left out.
+func (c CompanyModel) GetTree(ctx context.Context, ID uuid.UUID) (*CompanyTree, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT id, name, parent_id, 0 AS depth, ARRAY[id] AS path
+			FROM companies
+			WHERE id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id, c.name, c.parent_id, t.depth + 1, t.path || c.id
+			FROM companies c
+			JOIN tree t ON c.parent_id = t.id
+			WHERE c.deleted_at IS NULL AND NOT c.id = ANY(t.path)
+		)
+		SELECT
+			t.id,
+			t.name,
+			t.parent_id,
+			t.depth,
+			(SELECT count(*) FROM contacts WHERE company_id = t.id AND deleted_at IS NULL),
+			(
+				SELECT COALESCE(SUM(` + productValue + `), 0)
+				FROM quotes q
+				JOIN products p ON p.quote_id = q.id
+				WHERE q.company_id = t.id AND q.deleted_at IS NULL
+			)::float8
+		FROM tree t
+		ORDER BY t.depth, t.name, t.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "CompanyModel.GetTree", query)
+	defer span.End()
+
+	rows, err := c.DB.QueryContext(ctx, query, ID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer rows.Close()
+
+	nodes := make(map[uuid.UUID]*CompanyNode)
+	var root *CompanyNode
+
+	for rows.Next() {
+		node := CompanyNode{Children: []*CompanyNode{}}
+
+		err := rows.Scan(&node.ID, &node.Name, &node.ParentID, &node.Depth, &node.Contacts, &node.QuoteValue)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		// Rows come shallowest first, so a company's parent is already
+		// in the tree.
+		if node.Depth == 0 {
+			root = &node
+		} else {
+			parent := nodes[*node.ParentID]
+			parent.Children = append(parent.Children, &node)
+		}
+		nodes[node.ID] = &node
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	if root == nil {
+		return nil, spanError(span, sql.ErrNoRows)
+	}
+	root.rollup()
+
+	ancestors, err := c.ancestors(ctx, ID)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, len(nodes))
+
+	return &CompanyTree{Ancestors: ancestors, Root: root}, nil
+}
+
+// ancestors returns the companies above ID, from the top down.
+func (c CompanyModel) ancestors(ctx context.Context, ID uuid.UUID) ([]CompanyRef, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT parent_id AS id, 1 AS height, ARRAY[id] AS path
+			FROM companies
+			WHERE id = $1
+			UNION ALL
+			SELECT c.parent_id, a.height + 1, a.path || c.id
+			FROM companies c
+			JOIN ancestors a ON c.id = a.id
+			WHERE NOT c.id = ANY(a.path)
+		)
+		SELECT c.id, c.name, c.sales_owner
+		FROM ancestors a
+		JOIN companies c ON c.id = a.id
+		WHERE c.deleted_at IS NULL
+		ORDER BY a.height DESC
+	`
+
+	rows, err := c.DB.QueryContext(ctx, query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ancestors := []CompanyRef{}
+	for rows.Next() {
+		var ref CompanyRef
+
+		err := rows.Scan(&ref.ID, &ref.Name, &ref.SalesOwner)
+		if err != nil {
+			return nil, err
+		}
+
+		ancestors = append(ancestors, ref)
+	}
+
+	return ancestors, rows.Err()
+}
@@ -0,0 +1,239 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Import job statuses.
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportError is a problem with one field of an imported row. Row is the
+// spreadsheet row number, counting the header as row 1, or for vCard files
+// the card's position.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ImportJob tracks a CSV import. Rows are counted as they are processed so
+// clients can poll for progress; Errors is only loaded by GetErrors.
+type ImportJob struct {
+	ID            uuid.UUID     `json:"id"`
+	OwnerID       uuid.UUID     `json:"owner_id"`
+	Entity        string        `json:"entity"`
+	Status        string        `json:"status"`
+	DryRun        bool          `json:"dry_run"`
+	TotalRows     int           `json:"total_rows"`
+	ProcessedRows int           `json:"processed_rows"`
+	CreatedRows   int           `json:"created_rows"`
+	UpdatedRows   int           `json:"updated_rows"`
+	FailedRows    int           `json:"failed_rows"`
+	Errors        []ImportError `json:"errors,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	FinishedAt    *time.Time    `json:"finished_at"`
+}
+
+// VisibleTo reports whether user may see the job.
+func (j ImportJob) VisibleTo(user *User) bool {
+	return !user.IsAnonymous() && (j.OwnerID == user.ID || user.Role == RoleAdmin)
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+func (m ImportJobModel) Insert(ctx context.Context, job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs
+		(owner_id, entity, status, dry_run, total_rows)
+		VALUES
+		($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+
+	args := []any{job.OwnerID, job.Entity, job.Status, job.DryRun, job.TotalRows}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ImportJobModel.Insert", query)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+func (m ImportJobModel) GetByID(ctx context.Context, ID uuid.UUID) (*ImportJob, error) {
+	query := `
+		SELECT
+			id, owner_id, entity, status, dry_run, total_rows, processed_rows,
+			created_rows, updated_rows, failed_rows, created_at, updated_at, finished_at
+		FROM import_jobs
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ImportJobModel.GetByID", query)
+	defer span.End()
+
+	var job ImportJob
+	err := m.DB.QueryRowContext(ctx, query, ID).Scan(
+		&job.ID,
+		&job.OwnerID,
+		&job.Entity,
+		&job.Status,
+		&job.DryRun,
+		&job.TotalRows,
+		&job.ProcessedRows,
+		&job.CreatedRows,
+		&job.UpdatedRows,
+		&job.FailedRows,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return &job, nil
+}
+
+// GetErrors returns the row errors of a job, in row order.
+func (m ImportJobModel) GetErrors(ctx context.Context, ID uuid.UUID) ([]ImportError, error) {
+	query := `SELECT errors FROM import_jobs WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ImportJobModel.GetErrors", query)
+	defer span.End()
+
+	var js []byte
+	err := m.DB.QueryRowContext(ctx, query, ID).Scan(&js)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	var errs []ImportError
+	err = json.Unmarshal(js, &errs)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, len(errs))
+
+	return errs, nil
+}
+
+// Update saves the job's status and progress. Errors are saved along with
+// them, so callers should update sparingly on large imports.
+func (m ImportJobModel) Update(ctx context.Context, job *ImportJob) error {
+	query := `
+		UPDATE import_jobs
+		SET status = $1,
+		processed_rows = $2,
+		created_rows = $3,
+		updated_rows = $4,
+		failed_rows = $5,
+		errors = $6,
+		finished_at = $7,
+		updated_at = NOW()
+		WHERE id = $8
+		RETURNING updated_at
+	`
+
+	errs := job.Errors
+	if errs == nil {
+		errs = []ImportError{}
+	}
+
+	js, err := json.Marshal(errs)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		job.Status,
+		job.ProcessedRows,
+		job.CreatedRows,
+		job.UpdatedRows,
+		job.FailedRows,
+		js,
+		job.FinishedAt,
+		job.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ImportJobModel.Update", query)
+	defer span.End()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&job.UpdatedAt)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+// existingEmails returns which of emails are already used in table, so a
+// dry run can tell creates from updates.
+func existingEmails(ctx context.Context, db *sql.DB, name, table string, emails []string) (map[string]bool, error) {
+	query := `SELECT email FROM ` + table + ` WHERE email = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, name, query)
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(emails))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, spanError(span, err)
+		}
+		existing[email] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, len(existing))
+
+	return existing, nil
+}
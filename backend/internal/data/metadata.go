@@ -12,15 +12,64 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+
+	// Conditions restrict the rows returned. Each must name a field in
+	// FilterSafeList and use one of its operators.
+	Conditions     []Condition
+	FilterSafeList map[string]FilterField
+
+	// customSorts maps the sort columns AddCustomFields adds to their SQL
+	// expressions.
+	customSorts map[string]string
+
+	// IncludeSubsidiaries widens conditions on company fields to the
+	// companies below the ones given.
+	IncludeSubsidiaries bool
+
+	// Search is free text matched against the entity's full-text index.
+	// Results can then be sorted by "-relevance".
+	Search string
+
+	// Keyset switches GetAll from OFFSET paging to keyset paging: PageSize
+	// rows after the opaque cursor After, or from the start if After is
+	// empty. Totals are only counted when IncludeTotal is set, as that
+	// costs a full scan.
+	Keyset       bool
+	After        string
+	IncludeTotal bool
+
+	// unpaged returns every row, for exports.
+	unpaged bool
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than 0")
 	v.Check(f.Page < 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than 0")
-	v.Check(f.PageSize < 10_000_000, "page_size", "must be a maximum of 10 million")
+	sizeKey := "page_size"
+	if f.Keyset {
+		sizeKey = "limit"
+	}
+	v.Check(f.PageSize > 0, sizeKey, "must be greater than 0")
+	v.Check(f.PageSize < 10_000_000, sizeKey, "must be a maximum of 10 million")
 
 	v.Check(validator.PermittedValues(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	validateConditions(v, f)
+
+	v.Check(len(f.Search) <= 200, "q", "must not be more than 200 bytes long")
+
+	if f.Keyset {
+		v.Check(f.PageSize <= 100, "limit", "must be a maximum of 100")
+
+		if f.After != "" {
+			cursor, err := decodeCursor(f.After)
+			if err != nil {
+				v.AddError("after", "invalid cursor")
+			} else {
+				v.Check(cursor.Sort == f.Sort, "after", "cursor was issued for a different sort")
+			}
+		}
+	}
 }
 
 func (f Filters) limit() int {
@@ -47,11 +96,13 @@ func (f Filters) sortDirection() string {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitzero"`
-	PageSize     int `json:"page_size,omitzero"`
-	FirstPage    int `json:"first_page,omitzero"`
-	LastPage     int `json:"last_page,omitzero"`
-	TotalRecords int `json:"total_records,omitzero"`
+	CurrentPage  int    `json:"current_page,omitzero"`
+	PageSize     int    `json:"page_size,omitzero"`
+	FirstPage    int    `json:"first_page,omitzero"`
+	LastPage     int    `json:"last_page,omitzero"`
+	TotalRecords int    `json:"total_records,omitzero"`
+	Limit        int    `json:"limit,omitzero"`
+	NextCursor   string `json:"next_cursor,omitzero"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -8,27 +8,47 @@ import (
 var (
 	ErrEditConflict   = errors.New("edit conflict")
 	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicateName  = errors.New("duplicate name")
+	ErrDuplicateKey   = errors.New("duplicate key")
 	ErrInvalidUUID    = errors.New("invalid id")
+	ErrNotPermitted   = errors.New("not permitted")
+	ErrHasDependents  = errors.New("has dependents")
+	ErrCompanyCycle   = errors.New("company cycle")
+	ErrSelfMerge      = errors.New("merge into itself")
 )
 
 type Models struct {
-	Users     UserModel
-	Tokens    TokenModel
-	Companies CompanyModel
-	Contacts  ContactModel
-	Quotes    QuoteModel
-	Products  ProductModel
-	Projects  ProjectModel
+	Users        UserModel
+	Tokens       TokenModel
+	Companies    CompanyModel
+	Contacts     ContactModel
+	Quotes       QuoteModel
+	Products     ProductModel
+	Projects     ProjectModel
+	Schema       SchemaModel
+	Search       SearchModel
+	Views        SavedViewModel
+	Imports      ImportJobModel
+	Trash        TrashModel
+	Tags         TagModel
+	CustomFields CustomFieldModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Users:     UserModel{DB: db},
-		Tokens:    TokenModel{DB: db},
-		Companies: CompanyModel{DB: db},
-		Contacts:  ContactModel{DB: db},
-		Quotes:    QuoteModel{DB: db},
-		Products:  ProductModel{DB: db},
-		Projects:  ProjectModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Companies:    CompanyModel{DB: db},
+		Contacts:     ContactModel{DB: db},
+		Quotes:       QuoteModel{DB: db},
+		Products:     ProductModel{DB: db},
+		Projects:     ProjectModel{DB: db},
+		Schema:       SchemaModel{DB: db},
+		Search:       SearchModel{DB: db},
+		Views:        SavedViewModel{DB: db},
+		Imports:      ImportJobModel{DB: db},
+		Trash:        TrashModel{DB: db},
+		Tags:         TagModel{DB: db},
+		CustomFields: CustomFieldModel{DB: db},
 	}
 }
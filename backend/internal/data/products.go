@@ -12,10 +12,10 @@ import (
 type Product struct {
 	ID        uuid.UUID `json:"id"`
 	QuoteID   uuid.UUID `json:"quote_id"`
-	Title     string    `json:"title"`
-	UnitPrice int       `json:"unit_price"`
-	Quantity  int       `json:"quantity"`
-	Discount  int       `json:"discount"`
+	Title     string    `json:"title" validate:"required,max=255"`
+	UnitPrice int       `json:"unit_price" validate:"required,min=1,max=9999999"`
+	Quantity  int       `json:"quantity" validate:"min=0,max=999999"`
+	Discount  int       `json:"discount" validate:"min=0,max=99"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -24,7 +24,7 @@ type ProductModel struct {
 	DB *sql.DB
 }
 
-func (p ProductModel) Insert(product *Product) error {
+func (p ProductModel) Insert(ctx context.Context, product *Product) error {
 	query := `
 		INSERT INTO products
 			(quote_id, title, unit_price, quantity, discount)
@@ -33,9 +33,12 @@ func (p ProductModel) Insert(product *Product) error {
 		RETURNING id
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProductModel.Insert", query)
+	defer span.End()
+
 	args := []any{
 		product.QuoteID,
 		product.Title,
@@ -44,12 +47,19 @@ func (p ProductModel) Insert(product *Product) error {
 		product.Discount,
 	}
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(
 		&product.ID,
 	)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
 }
 
-func (p ProductModel) GetProductByID(ID uuid.UUID) (*Product, error) {
+func (p ProductModel) GetProductByID(ctx context.Context, ID uuid.UUID) (*Product, error) {
 	query := `
 		SELECT 
 			id, 
@@ -64,9 +74,12 @@ func (p ProductModel) GetProductByID(ID uuid.UUID) (*Product, error) {
 		WHERE id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProductModel.GetProductByID", query)
+	defer span.End()
+
 	var product Product
 	err := p.DB.QueryRowContext(ctx, query, ID).Scan(
 		&product.ID,
@@ -79,31 +92,38 @@ func (p ProductModel) GetProductByID(ID uuid.UUID) (*Product, error) {
 		&product.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
-	return &product, err
+	spanRows(span, 1)
+
+	return &product, nil
 }
 
-func (p ProductModel) GetProductsByQuoteID(ID uuid.UUID) ([]*Product, error) {
+func (p ProductModel) GetProductsByQuoteID(ctx context.Context, ID uuid.UUID) ([]*Product, error) {
 	query := `
 		SELECT
-			id,
-			quote_id,
-			title,
-			unit_price,
-			quantity,
-			discount
-		FROM products
-		WHERE quote_id = $1
+			p.id,
+			p.quote_id,
+			p.title,
+			p.unit_price,
+			p.quantity,
+			p.discount
+		FROM products p
+		JOIN quotes q
+		ON p.quote_id = q.id
+		WHERE p.quote_id = $1 AND q.deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProductModel.GetProductsByQuoteID", query)
+	defer span.End()
+
 	rows, err := p.DB.QueryContext(ctx, query, ID)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
 	defer rows.Close()
@@ -121,17 +141,19 @@ func (p ProductModel) GetProductsByQuoteID(ID uuid.UUID) ([]*Product, error) {
 			&product.Discount,
 		)
 		if err != nil {
-			return nil, err
+			return nil, spanError(span, err)
 		}
 
 		products = append(products, &product)
 	}
 
+	spanRows(span, len(products))
+
 	return products, nil
 
 }
 
-func (p ProductModel) Update(product *Product) (*Product, error) {
+func (p ProductModel) Update(ctx context.Context, product *Product) (*Product, error) {
 	query := `
 		UPDATE products
 		SET title = $1,
@@ -142,9 +164,12 @@ func (p ProductModel) Update(product *Product) (*Product, error) {
 		WHERE id = $1
 		RETURNING updated_at
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProductModel.Update", query)
+	defer span.End()
+
 	args := []any{
 		product.Title,
 		product.UnitPrice,
@@ -156,31 +181,38 @@ func (p ProductModel) Update(product *Product) (*Product, error) {
 		&product.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return product, nil
 }
 
-func (p ProductModel) Delete(ID uuid.UUID) error {
+func (p ProductModel) Delete(ctx context.Context, ID uuid.UUID) error {
 	query := `
 		DELETE FROM products
 		where id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProductModel.Delete", query)
+	defer span.End()
+
 	rows, err := p.DB.ExecContext(ctx, query, ID)
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
 	affectedRows, err := rows.RowsAffected()
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
+	spanRows(span, int(affectedRows))
+
 	if affectedRows == 0 {
 		return sql.ErrNoRows
 	}
@@ -190,10 +222,5 @@ func (p ProductModel) Delete(ID uuid.UUID) error {
 }
 
 func (p Product) ValidateProduct(v *validator.Validator) {
-	v.Check(p.Title != "", "title", "title is required")
-	v.Check(len(p.Title) < 255, "title", "title must not exceed 255 chaaracters")
-	v.Check(p.UnitPrice > 0, "unit_price", "unit_price mut be valid")
-	v.Check(p.UnitPrice < 10_000_000, "unit_price", "unit_price must not exceed 10,000,000")
-	v.Check(p.Quantity < 1_000_000, "quantity", "quantity must not exceed 1,000,000")
-	v.Check(p.Discount < 100, "quantity", "quantity must not exceed 100")
+	v.Struct(p)
 }
@@ -13,9 +13,9 @@ import (
 type Project struct {
 	ID          uuid.UUID `json:"id"`
 	CompanyID   uuid.UUID `json:"company_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
+	Title       string    `json:"title" validate:"required,max=255"`
+	Description string    `json:"description" validate:"required"`
+	Status      string    `json:"status" validate:"required,max=255"`
 	OwnerID     uuid.UUID `json:"owner_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -25,7 +25,7 @@ type ProjectModel struct {
 	DB *sql.DB
 }
 
-func (p ProjectModel) Insert(project *Project) error {
+func (p ProjectModel) Insert(ctx context.Context, project *Project) error {
 	query := `
 		INSERT into products
 		(company_id, title, description, status, owner_id)
@@ -34,9 +34,12 @@ func (p ProjectModel) Insert(project *Project) error {
 		RETURNING id, created_at, updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProjectModel.Insert", query)
+	defer span.End()
+
 	args := []any{
 		project.CompanyID,
 		project.Title,
@@ -45,22 +48,25 @@ func (p ProjectModel) Insert(project *Project) error {
 		project.OwnerID,
 	}
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(
 		project.ID,
 		project.CreatedAt,
 		project.UpdatedAt,
 	)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
 }
 
 func (project Project) Validate(v *validator.Validator) {
-	v.Check(project.Title != "", "title", "title is required")
-	v.Check(len(project.Title) <= 255, "title", "title must not exceed 255 characters")
-	v.Check(project.Description != "", "description", "description is required")
-	v.Check(project.Status != "", "status", "status is required")
-	v.Check(len(project.Status) <= 255, "status", "status must not exceed 255 characters")
+	v.Struct(project)
 }
 
-func (p ProjectModel) GetByID(ID uuid.UUID) (*Project, error) {
+func (p ProjectModel) GetByID(ctx context.Context, ID uuid.UUID) (*Project, error) {
 	query := `
 		SELECT 
 			id,
@@ -72,12 +78,15 @@ func (p ProjectModel) GetByID(ID uuid.UUID) (*Project, error) {
 			created_at,
 			updated_at
 		FROM projects
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProjectModel.GetByID", query)
+	defer span.End()
+
 	var project Project
 	err := p.DB.QueryRowContext(ctx, query, ID).Scan(
 		&project.ID,
@@ -90,13 +99,15 @@ func (p ProjectModel) GetByID(ID uuid.UUID) (*Project, error) {
 		&project.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &project, nil
 }
 
-func (p ProjectModel) GetAllByCompanyID(ID uuid.UUID, filters Filters) ([]*Project, Metadata, error) {
+func (p ProjectModel) GetAllByCompanyID(ctx context.Context, ID uuid.UUID, filters Filters) ([]*Project, Metadata, error) {
 	query := fmt.Sprintf(`
 		SELECT
 			count(id) over(),
@@ -109,20 +120,23 @@ func (p ProjectModel) GetAllByCompanyID(ID uuid.UUID, filters Filters) ([]*Proje
 			created_at,
 			updated_at,
 		FROM projects
-		WHERE company_id = $1
+		WHERE company_id = $1 AND deleted_at IS NULL
 		ORDER BY %s %s, c.created_at DESC
 		LIMIT $2 OFFSET $3
 
 	`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "ProjectModel.GetAllByCompanyID", query)
+	defer span.End()
+
 	args := []any{ID, filters.limit(), filters.offset()}
 
 	rows, err := p.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, spanError(span, err)
 	}
 	defer rows.Close()
 
@@ -144,7 +158,7 @@ func (p ProjectModel) GetAllByCompanyID(ID uuid.UUID, filters Filters) ([]*Proje
 			&project.UpdatedAt,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, spanError(span, err)
 		}
 
 		projects = append(projects, &project)
@@ -152,5 +166,39 @@ func (p ProjectModel) GetAllByCompanyID(ID uuid.UUID, filters Filters) ([]*Proje
 	}
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	spanRows(span, len(projects))
+
 	return projects, metadata, nil
 }
+
+func (p ProjectModel) Delete(ctx context.Context, ID uuid.UUID) error {
+	query := `
+		UPDATE projects
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "ProjectModel.Delete", query)
+	defer span.End()
+
+	rows, err := p.DB.ExecContext(ctx, query, ID)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := rows.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
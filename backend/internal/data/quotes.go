@@ -11,28 +11,29 @@ import (
 )
 
 type Quote struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	CompanyID   uuid.UUID `json:"company_id"`
-	SalesTax    int       `json:"sales_tax"`
-	Stage       string    `json:"stage"`
-	Notes       string    `json:"notes"`
-	PreparedBy  uuid.UUID `json:"prepared_by"`
-	PreparedFor uuid.UUID `json:"prepared_for"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name" validate:"required,max=255"`
+	CompanyID    uuid.UUID    `json:"company_id"`
+	SalesTax     int          `json:"sales_tax" validate:"min=0"`
+	Stage        string       `json:"stage" validate:"required,max=255"`
+	Notes        string       `json:"notes" validate:"max=10000"`
+	PreparedBy   uuid.UUID    `json:"prepared_by"`
+	PreparedFor  uuid.UUID    `json:"prepared_for"`
+	CustomFields CustomFields `json:"custom_fields"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 type QuoteModel struct {
 	DB *sql.DB
 }
 
-func (q QuoteModel) Insert(quote *Quote) error {
+func (q QuoteModel) Insert(ctx context.Context, quote *Quote) error {
 	query := `
 		INSERT INTO quotes
-			(name, company_id, sales_tax, stage, notes, prepared_by, prepared_for)
+			(name, company_id, sales_tax, stage, notes, prepared_by, prepared_for, custom_fields)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7)
+			($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -44,19 +45,30 @@ func (q QuoteModel) Insert(quote *Quote) error {
 		quote.Notes,
 		quote.PreparedBy,
 		quote.PreparedFor,
+		quote.CustomFields,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return q.DB.QueryRowContext(ctx, query, args...).Scan(
+	ctx, span := startSpan(ctx, "QuoteModel.Insert", query)
+	defer span.End()
+
+	err := q.DB.QueryRowContext(ctx, query, args...).Scan(
 		&quote.ID,
 		&quote.CreatedAt,
 		&quote.UpdatedAt,
 	)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
 }
 
-func (q QuoteModel) GetByID(ID uuid.UUID) (*Quote, error) {
+func (q QuoteModel) GetByID(ctx context.Context, ID uuid.UUID) (*Quote, error) {
 	query := `
 		SELECT 
 			id,
@@ -67,15 +79,19 @@ func (q QuoteModel) GetByID(ID uuid.UUID) (*Quote, error) {
 			notes,
 			prepared_by,
 			prepared_for,
+			custom_fields,
 			created_at,
 			updated_at
 		FROM quotes
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "QuoteModel.GetByID", query)
+	defer span.End()
+
 	var quote Quote
 	err := q.DB.QueryRowContext(ctx, query, ID).Scan(
 		&quote.ID,
@@ -86,36 +102,64 @@ func (q QuoteModel) GetByID(ID uuid.UUID) (*Quote, error) {
 		&quote.Notes,
 		&quote.PreparedBy,
 		&quote.PreparedFor,
+		&quote.CustomFields,
 		&quote.CreatedAt,
 		&quote.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &quote, nil
 }
 
 type QuoteWithRelationNames struct {
-	ID              uuid.UUID `json:"id"`
-	Name            string    `json:"name"`
-	CompanyID       uuid.UUID `json:"company_id"`
-	CompanyName     string    `json:"company_name"`
-	SalesTax        int       `json:"sales_tax"`
-	Stage           string    `json:"stage"`
-	Notes           string    `json:"notes"`
-	PreparedBy      uuid.UUID `json:"prepared_by"`
-	PreparedByName  string    `json:"prepared_by_name"`
-	PreparedFor     uuid.UUID `json:"prepared_for"`
-	PreparedForName string    `json:"prepared_for_name"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uuid.UUID    `json:"id"`
+	Name            string       `json:"name"`
+	CompanyID       uuid.UUID    `json:"company_id"`
+	CompanyName     string       `json:"company_name"`
+	SalesTax        int          `json:"sales_tax"`
+	Stage           string       `json:"stage"`
+	Notes           string       `json:"notes"`
+	PreparedBy      uuid.UUID    `json:"prepared_by"`
+	PreparedByName  string       `json:"prepared_by_name"`
+	PreparedFor     uuid.UUID    `json:"prepared_for"`
+	PreparedForName string       `json:"prepared_for_name"`
+	Tags            TagRefs      `json:"tags"`
+	CustomFields    CustomFields `json:"custom_fields"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
 }
 
-func (q QuoteModel) GetAll(filter Filters) ([]*QuoteWithRelationNames, Metadata, error) {
+// listQuery returns the query GetAll and Export run for filters, the FROM
+// clause it selects from and how many of args that clause uses.
+func (q QuoteModel) listQuery(filters Filters) (string, string, []any, int, error) {
+	conditions, args := filters.where(nil)
+	countArgs := len(args)
+
+	from := fmt.Sprintf(`
+		FROM quotes q
+		JOIN companies c
+			ON q.company_id = c.id
+		JOIN users cn
+			ON q.prepared_by = cn.id
+		JOIN contacts cnb
+			ON q.prepared_for = cnb.id
+		WHERE q.deleted_at IS NULL AND c.deleted_at IS NULL AND %s`, conditions)
+
+	sortExpr := filters.sortExpr("q", nil)
+
+	after, window, args, err := filters.window(sortExpr, "q.id", args)
+	if err != nil {
+		return "", "", nil, 0, err
+	}
+
 	query := fmt.Sprintf(`
 		SELECT
-			count(q.id) over(),
+			%s,
+			%s::text,
 			q.id,
 			q.name,
 			q.company_id,
@@ -127,64 +171,146 @@ func (q QuoteModel) GetAll(filter Filters) ([]*QuoteWithRelationNames, Metadata,
 			cn.first_name || ' ' || cn.last_name AS prepared_by_name,
 			cnb.id AS prepared_for,
 			cnb.name AS prepared_for_name,
+			%s,
+			q.custom_fields,
 			q.created_at,
 			q.updated_at
-		FROM quotes q
-		JOIN companies c
-			ON q.company_id = c.id
-		JOIN users cn
-			ON q.prepared_by = cn.id
-		JOIN contacts cnb
-			ON q.prepared_for = cnb.id
-		ORDER BY %s %s, q.created_at DESC
-		LIMIT $1 OFFSET $2
-	`, filter.sortColumn(), filter.sortDirection())
+		%s AND %s
+		%s
+	`, filters.countExpr("q.id"), sortExpr, tagsColumn("quotes", "q.id"), from, after, window)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return query, from, args, countArgs, nil
+}
+
+func scanQuoteWithRelationNames(rows *sql.Rows, totalRecords *int, sortValue *string) (*QuoteWithRelationNames, error) {
+	var quote QuoteWithRelationNames
+
+	err := rows.Scan(
+		totalRecords,
+		sortValue,
+		&quote.ID,
+		&quote.Name,
+		&quote.CompanyID,
+		&quote.CompanyName,
+		&quote.SalesTax,
+		&quote.Stage,
+		&quote.Notes,
+		&quote.PreparedBy,
+		&quote.PreparedByName,
+		&quote.PreparedFor,
+		&quote.PreparedForName,
+		&quote.Tags,
+		&quote.CustomFields,
+		&quote.CreatedAt,
+		&quote.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+func (q QuoteModel) GetAll(ctx context.Context, filters Filters) ([]*QuoteWithRelationNames, Metadata, error) {
+	query, from, args, countArgs, err := q.listQuery(filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	args := []any{filter.limit(), filter.offset()}
+	ctx, span := startSpan(ctx, "QuoteModel.GetAll", query)
+	defer span.End()
 
 	rows, err := q.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, spanError(span, err)
 	}
 	defer rows.Close()
 
 	totalRecords := 0
 	quotes := []*QuoteWithRelationNames{}
+	sortValues := []string{}
 
 	for rows.Next() {
-		var quote QuoteWithRelationNames
-		err := rows.Scan(
-			&totalRecords,
-			&quote.ID,
-			&quote.Name,
-			&quote.CompanyID,
-			&quote.CompanyName,
-			&quote.SalesTax,
-			&quote.Stage,
-			&quote.Notes,
-			&quote.PreparedBy,
-			&quote.PreparedByName,
-			&quote.PreparedFor,
-			&quote.PreparedForName,
-			&quote.CreatedAt,
-			&quote.UpdatedAt,
-		)
+		var sortValue string
+
+		quote, err := scanQuoteWithRelationNames(rows, &totalRecords, &sortValue)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, spanError(span, err)
 		}
 
-		quotes = append(quotes, &quote)
+		quotes = append(quotes, quote)
+		sortValues = append(sortValues, sortValue)
 	}
 
-	metadata := calculateMetadata(totalRecords, filter.Page, filter.PageSize)
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	if filters.Keyset && filters.IncludeTotal {
+		err = q.DB.QueryRowContext(ctx, "SELECT count(*) "+from, args[:countArgs]...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+	}
+
+	quotes, metadata := paginate(filters, quotes, sortValues, func(q *QuoteWithRelationNames) uuid.UUID { return q.ID }, totalRecords)
+
+	spanRows(span, len(quotes))
 
 	return quotes, metadata, nil
 }
 
-func (q QuoteModel) Update(quote *Quote) error {
+// Export calls fn with every quote matching filters, in order, as rows
+// are read from the database. Paging is ignored.
+func (q QuoteModel) Export(ctx context.Context, filters Filters, fn func(*QuoteWithRelationNames) error) error {
+	filters.unpaged = true
+
+	query, _, args, _, err := q.listQuery(filters)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "QuoteModel.Export", query)
+	defer span.End()
+
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer rows.Close()
+
+	var totalRecords, exported int
+	var sortValue string
+
+	for rows.Next() {
+		quote, err := scanQuoteWithRelationNames(rows, &totalRecords, &sortValue)
+		if err != nil {
+			return spanError(span, err)
+		}
+
+		err = fn(quote)
+		if err != nil {
+			return spanError(span, err)
+		}
+		exported++
+	}
+
+	if err = rows.Err(); err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, exported)
+
+	return nil
+}
+
+func (q QuoteModel) Update(ctx context.Context, quote *Quote) error {
 	query := `
 		UPDATE quotes
 		SET name = $1,
@@ -193,14 +319,18 @@ func (q QuoteModel) Update(quote *Quote) error {
 		prepared_for = $4,
 		stage = $5,
 		notes = $6,
+		custom_fields = $8,
 		updated_at = NOW()
-		WHERE id = $7
+		WHERE id = $7 AND deleted_at IS NULL
 		returning updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "QuoteModel.Update", query)
+	defer span.End()
+
 	args := []any{
 		quote.Name,
 		quote.CompanyID,
@@ -209,33 +339,46 @@ func (q QuoteModel) Update(quote *Quote) error {
 		quote.Stage,
 		quote.Notes,
 		quote.ID,
+		quote.CustomFields,
 	}
 
-	return q.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := q.DB.QueryRowContext(ctx, query, args...).Scan(
 		&quote.UpdatedAt,
 	)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
 
+	return nil
 }
 
-func (q QuoteModel) Delete(ID uuid.UUID) error {
+func (q QuoteModel) Delete(ctx context.Context, ID uuid.UUID) error {
 	query := `
-		DELETE FROM quotes
-		WHERE id = $1
+		UPDATE quotes
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "QuoteModel.Delete", query)
+	defer span.End()
+
 	rows, err := q.DB.ExecContext(ctx, query, ID)
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
 	affected, err := rows.RowsAffected()
 	if err != nil {
-		return err
+		return spanError(span, err)
 	}
 
+	spanRows(span, int(affected))
+
 	if affected == 0 {
 		return sql.ErrNoRows
 	}
@@ -245,10 +388,5 @@ func (q QuoteModel) Delete(ID uuid.UUID) error {
 }
 
 func (q Quote) ValidateQuote(v *validator.Validator) {
-	v.Check(q.Name != "", "name", "name is required")
-	v.Check(len(q.Name) < 255, "name", "name must not exceed 255 characters")
-	v.Check(q.SalesTax > -1, "sales_tax", "sales_tax must be valid")
-	v.Check(q.Stage != "", "stage", "stage is required")
-	v.Check(len(q.Stage) < 255, "stage", "stage must not exceed 255 characters")
-	v.Check(len(q.Notes) < 10000, "notes", "notes must not exceed 10,000 characters")
+	v.Struct(q)
 }
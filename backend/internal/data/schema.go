@@ -0,0 +1,52 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SchemaModel struct {
+	DB *sql.DB
+}
+
+func (s SchemaModel) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.DB.PingContext(ctx)
+}
+
+// MigrationVersion returns the version recorded by golang-migrate in the
+// schema_migrations table and whether the last migration left it dirty.
+func (s SchemaModel) MigrationVersion(ctx context.Context) (int64, bool, error) {
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SchemaModel.MigrationVersion", query)
+	defer span.End()
+
+	var version int64
+	var dirty bool
+
+	err := s.DB.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return version, dirty, nil
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// searchFields says where full-text search looks for a table.
+type searchFields struct {
+	// vector is the generated tsvector column.
+	vector string
+	// trigram is compared by trigram similarity to catch typos.
+	trigram string
+	// headline is the text highlighted in the response.
+	headline string
+}
+
+var companySearch = searchFields{
+	vector:   "c.search",
+	trigram:  "c.name",
+	headline: "concat_ws(' · ', c.name, c.email, c.website, c.industry)",
+}
+
+var contactSearch = searchFields{
+	vector:   "c.search",
+	trigram:  "c.name",
+	headline: "concat_ws(' · ', c.name, c.email, c.title)",
+}
+
+var quoteSearch = searchFields{
+	vector:  "q.search",
+	trigram: "q.name",
+}
+
+var projectSearch = searchFields{
+	vector:  "p.search",
+	trigram: "p.title",
+}
+
+// prefixQuery turns free text into a to_tsquery expression matching every
+// word as a prefix, so "acm sol" finds "Acme Solutions" while typing.
+// Everything but letters and digits is dropped, which also keeps the
+// tsquery syntax out of users' hands.
+func prefixQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// exprs returns the condition matching the search and its relevance rank,
+// given placeholders for the prefix tsquery and the raw search text.
+func (s searchFields) exprs(query, text string) (string, string) {
+	match := fmt.Sprintf("(%s @@ %s OR %s %% %s)", s.vector, query, s.trigram, text)
+	rank := fmt.Sprintf("(ts_rank(%s, %s) + similarity(%s, %s))", s.vector, query, s.trigram, text)
+
+	return match, rank
+}
+
+// search returns the condition matching f.Search, its relevance rank and a
+// highlighted snippet, binding the search terms to args. Without a search
+// they are TRUE, NULL and NULL.
+func (f Filters) search(s searchFields, args []any) (string, string, string, []any) {
+	if f.Search == "" {
+		return "TRUE", "NULL::real", "NULL::text", args
+	}
+
+	args = append(args, prefixQuery(f.Search), f.Search)
+	query := fmt.Sprintf("to_tsquery('simple', $%d)", len(args)-1)
+
+	match, rank := s.exprs(query, fmt.Sprintf("$%d", len(args)))
+	headline := fmt.Sprintf(
+		"ts_headline('simple', %s, %s, 'StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5')",
+		escapeHTML(s.headline), query,
+	)
+
+	return match, rank, headline, args
+}
+
+// escapeHTML wraps a text expression so that it is HTML-escaped in SQL.
+// The source of a headline is escaped before the <mark> tags are added, so
+// the snippet is safe to render as HTML; the parser treats the entities as
+// single tokens that are never highlighted.
+func escapeHTML(expr string) string {
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}} {
+		expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, strings.ReplaceAll(r[0], "'", "''"), r[1])
+	}
+
+	return expr
+}
+
+// SearchHit is one result of a search across entity types.
+type SearchHit struct {
+	Type     string    `json:"type"`
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Subtitle *string   `json:"subtitle"`
+	Score    float64   `json:"score"`
+}
+
+// SearchGroups are the entity types Search returns, in display order.
+var SearchGroups = []string{"companies", "contacts", "quotes", "projects"}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// Search returns up to limit of the best matches for q from each of
+// SearchGroups. When owner is set, only records that user owns are
+// searched: companies they are the sales owner of and those companies'
+// contacts, quotes they prepared and projects they own.
+func (m SearchModel) Search(ctx context.Context, q string, owner *uuid.UUID, limit int) (map[string][]*SearchHit, error) {
+	const query, text, ownerArg, limitArg = "to_tsquery('simple', $1)", "$2", "$3::uuid", "$4"
+
+	companyMatch, companyRank := companySearch.exprs(query, text)
+	contactMatch, contactRank := contactSearch.exprs(query, text)
+	quoteMatch, quoteRank := quoteSearch.exprs(query, text)
+	projectMatch, projectRank := projectSearch.exprs(query, text)
+
+	// Each branch is limited on its own so one busy entity can't crowd out
+	// the others, and all four run in a single round trip.
+	stmt := fmt.Sprintf(`
+		(SELECT 'companies', c.id, c.name, c.industry, %[1]s AS score
+		FROM companies c
+		WHERE c.deleted_at IS NULL AND %[2]s
+		AND (%[9]s IS NULL OR c.sales_owner = %[9]s)
+		ORDER BY score DESC
+		LIMIT %[10]s)
+
+		UNION ALL
+
+		(SELECT 'contacts', c.id, c.name, o.name, %[3]s AS score
+		FROM contacts c
+		LEFT JOIN companies o
+		ON c.company_id = o.id
+		WHERE c.deleted_at IS NULL AND %[4]s
+		AND (%[9]s IS NULL OR o.sales_owner = %[9]s)
+		ORDER BY score DESC
+		LIMIT %[10]s)
+
+		UNION ALL
+
+		(SELECT 'quotes', q.id, q.name, o.name, %[5]s AS score
+		FROM quotes q
+		JOIN companies o
+		ON q.company_id = o.id
+		WHERE q.deleted_at IS NULL AND %[6]s
+		AND (%[9]s IS NULL OR q.prepared_by = %[9]s)
+		ORDER BY score DESC
+		LIMIT %[10]s)
+
+		UNION ALL
+
+		(SELECT 'projects', p.id, p.title, o.name, %[7]s AS score
+		FROM projects p
+		JOIN companies o
+		ON p.company_id = o.id
+		WHERE p.deleted_at IS NULL AND %[8]s
+		AND (%[9]s IS NULL OR p.owner_id = %[9]s)
+		ORDER BY score DESC
+		LIMIT %[10]s)
+	`,
+		companyRank, companyMatch,
+		contactRank, contactMatch,
+		quoteRank, quoteMatch,
+		projectRank, projectMatch,
+		ownerArg, limitArg,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SearchModel.Search", stmt)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, prefixQuery(q), q, owner, limit)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string][]*SearchHit, len(SearchGroups))
+	for _, group := range SearchGroups {
+		groups[group] = []*SearchHit{}
+	}
+
+	total := 0
+	for rows.Next() {
+		var hit SearchHit
+
+		err := rows.Scan(&hit.Type, &hit.ID, &hit.Title, &hit.Subtitle, &hit.Score)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		groups[hit.Type] = append(groups[hit.Type], &hit)
+		total++
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, total)
+
+	return groups, nil
+}
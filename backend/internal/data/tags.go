@@ -0,0 +1,390 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// TagEntities are the entity types whose records can be tagged.
+var TagEntities = []string{"companies", "contacts", "quotes", "projects"}
+
+// tagLink is the table linking an entity's records to tags and its column
+// holding the record's ID.
+type tagLink struct {
+	table, key string
+}
+
+var tagLinks = map[string]tagLink{
+	"companies": {table: "company_tags", key: "company_id"},
+	"contacts":  {table: "contact_tags", key: "contact_id"},
+	"quotes":    {table: "quote_tags", key: "quote_id"},
+	"projects":  {table: "project_tags", key: "project_id"},
+}
+
+// DefaultTagColor is the color of tags created without one.
+const DefaultTagColor = "#6b7280"
+
+var ColorRX = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Tag is a label such as "VIP" or "churn risk" that records of any of
+// TagEntities can carry. Names are unique regardless of case.
+type Tag struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name" validate:"required,max=50"`
+	Color string    `json:"color"`
+	// Usage is how many records carry the tag, in lists.
+	Usage     *int      `json:"usage,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Struct(tag)
+	v.Check(strings.TrimSpace(tag.Name) == tag.Name, "name", "must not start or end with spaces")
+	// Commas separate the values of ?tags=in:.
+	v.Check(!strings.Contains(tag.Name, ","), "name", "must not contain commas")
+	v.Check(validator.Matches(tag.Color, ColorRX), "color", "must be a hex color such as #ff8800")
+}
+
+// TagRef is a tag as listed on a tagged record.
+type TagRef struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Color string    `json:"color"`
+}
+
+// TagRefs scans the JSON array selected by tagsColumn.
+type TagRefs []TagRef
+
+func (t *TagRefs) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into TagRefs", src)
+	}
+
+	return json.Unmarshal(b, t)
+}
+
+// Names returns the names of the tags, for exports.
+func (t TagRefs) Names() []string {
+	names := make([]string, len(t))
+	for i, tag := range t {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// tagsColumn is a select expression of the tags of the entity's record
+// with ID idExpr, as a JSON array ordered by name.
+func tagsColumn(entity, idExpr string) string {
+	link := tagLinks[entity]
+
+	return fmt.Sprintf(`COALESCE((
+		SELECT json_agg(json_build_object('id', t.id, 'name', t.name, 'color', t.color) ORDER BY lower(t.name))
+		FROM %s l
+		JOIN tags t ON t.id = l.tag_id
+		WHERE l.%s = %s
+	), '[]')`, link.table, link.key, idExpr)
+}
+
+// taggedWith is a condition matching the entity's records with ID idExpr
+// that carry a tag named in the text array parameter param, ignoring case.
+func taggedWith(entity, idExpr, param string) string {
+	link := tagLinks[entity]
+
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1
+		FROM %s l
+		JOIN tags t ON t.id = l.tag_id
+		WHERE l.%s = %s AND lower(t.name) = ANY(%s::text[])
+	)`, link.table, link.key, idExpr, param)
+}
+
+// tagUsage is a select expression of how many records carry tag t.
+func tagUsage() string {
+	counts := make([]string, len(TagEntities))
+	for i, entity := range TagEntities {
+		counts[i] = fmt.Sprintf("(SELECT count(*) FROM %s WHERE tag_id = t.id)", tagLinks[entity].table)
+	}
+
+	return strings.Join(counts, " + ")
+}
+
+// TagChanges reports what a bulk tagging added and removed.
+type TagChanges struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+func (m TagModel) Insert(ctx context.Context, tag *Tag) error {
+	query := `
+		INSERT INTO tags
+		(name, color)
+		VALUES
+		($1, $2)
+		RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.Insert", query)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, tag.Name, tag.Color).Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tags_name_key"`:
+			return ErrDuplicateName
+		default:
+			return spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+func (m TagModel) GetByID(ctx context.Context, ID uuid.UUID) (*Tag, error) {
+	query := `
+		SELECT id, name, color, created_at, updated_at
+		FROM tags
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.GetByID", query)
+	defer span.End()
+
+	var tag Tag
+	err := m.DB.QueryRowContext(ctx, query, ID).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return &tag, nil
+}
+
+// GetAll returns a page of tags whose names start with prefix, ignoring
+// case, with how many records carry each, for autocomplete.
+func (m TagModel) GetAll(ctx context.Context, prefix string, filters Filters) ([]*Tag, Metadata, error) {
+	usage := tagUsage()
+	sortExpr := filters.sortExpr("t", map[string]string{"name": "lower(t.name)", "usage": usage})
+	direction := filters.sortDirection()
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), t.id, t.name, t.color, %s, t.created_at, t.updated_at
+		FROM tags t
+		WHERE lower(t.name) LIKE lower($1) || '%%'
+		ORDER BY %s %s, t.id %s
+		LIMIT $2 OFFSET $3
+	`, usage, sortExpr, direction, direction)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.GetAll", query)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query, escapeLike(prefix), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	tags := []*Tag{}
+
+	for rows.Next() {
+		var tag Tag
+		var usage int
+
+		err := rows.Scan(&totalRecords, &tag.ID, &tag.Name, &tag.Color, &usage, &tag.CreatedAt, &tag.UpdatedAt)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+		tag.Usage = &usage
+
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	spanRows(span, len(tags))
+
+	return tags, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m TagModel) Update(ctx context.Context, tag *Tag) error {
+	query := `
+		UPDATE tags
+		SET name = $1,
+		color = $2,
+		updated_at = NOW()
+		WHERE id = $3
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.Update", query)
+	defer span.End()
+
+	err := m.DB.QueryRowContext(ctx, query, tag.Name, tag.Color, tag.ID).Scan(&tag.UpdatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tags_name_key"`:
+			return ErrDuplicateName
+		default:
+			return spanError(span, err)
+		}
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+// Delete removes a tag from every record and then deletes it.
+func (m TagModel) Delete(ctx context.Context, ID uuid.UUID) error {
+	query := `DELETE FROM tags WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.Delete", query)
+	defer span.End()
+
+	result, err := m.DB.ExecContext(ctx, query, ID)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Apply tags each of the entity's records IDs with the tags add and
+// removes the tags remove from them, in one transaction. Tagging a record
+// with a tag it already carries changes nothing. ErrInvalidUUID is
+// returned unless every record exists and isn't deleted and every tag
+// exists.
+func (m TagModel) Apply(ctx context.Context, entity string, IDs, add, remove []uuid.UUID) (*TagChanges, error) {
+	link := tagLinks[entity]
+
+	query := fmt.Sprintf(`
+		SELECT
+			(SELECT count(*) FROM %s WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL),
+			(SELECT count(*) FROM tags WHERE id = ANY($2::uuid[]))
+	`, entity)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TagModel.Apply", query)
+	defer span.End()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	tags := append(append([]uuid.UUID{}, add...), remove...)
+
+	var records, found int
+	err = tx.QueryRowContext(ctx, query, pq.Array(IDs), pq.Array(tags)).Scan(&records, &found)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	if records != len(IDs) || found != len(tags) {
+		return nil, ErrInvalidUUID
+	}
+
+	changes := &TagChanges{}
+
+	if len(add) > 0 {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s (%s, tag_id)
+			SELECT r, t FROM unnest($1::uuid[]) r CROSS JOIN unnest($2::uuid[]) t
+			ON CONFLICT DO NOTHING
+		`, link.table, link.key), pq.Array(IDs), pq.Array(add))
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+		changes.Added = int(n)
+	}
+
+	if len(remove) > 0 {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`
+			DELETE FROM %s WHERE %s = ANY($1::uuid[]) AND tag_id = ANY($2::uuid[])
+		`, link.table, link.key), pq.Array(IDs), pq.Array(remove))
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+		changes.Removed = int(n)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, changes.Added+changes.Removed)
+
+	return changes, nil
+}
+
+// copyTags gives the entity's record to the tags of its records from, as
+// part of tx, so a merge keeps the duplicates' tags.
+func copyTags(ctx context.Context, tx *sql.Tx, entity string, to uuid.UUID, from []uuid.UUID) error {
+	link := tagLinks[entity]
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s, tag_id)
+		SELECT DISTINCT $1::uuid, tag_id FROM %[1]s WHERE %[2]s = ANY($2::uuid[])
+		ON CONFLICT DO NOTHING
+	`, link.table, link.key), to, pq.Array(from))
+	return err
+}
@@ -29,15 +29,15 @@ type TokenModel struct {
 	DB *sql.DB
 }
 
-func (t TokenModel) New(userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
+func (t TokenModel) New(ctx context.Context, userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
 	token := generateToken(userID, ttl, scope)
 
-	err := t.Insert(token)
+	err := t.Insert(ctx, token)
 
 	return token, err
 }
 
-func (t TokenModel) Insert(token *Token) error {
+func (t TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
 		INSERT INTO tokens 
 		(hash, user_id, expiry, scope)
@@ -46,19 +46,22 @@ func (t TokenModel) Insert(token *Token) error {
 	`
 	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "TokenModel.Insert", query)
+	defer span.End()
+
 	_, err := t.DB.ExecContext(ctx, query, args...)
 
-	return err
+	return spanError(span, err)
 }
 
-func (t TokenModel) GetForToken(tokenScope, plainTextToken string) (*User, error) {
+func (t TokenModel) GetForToken(ctx context.Context, tokenScope, plainTextToken string) (*User, error) {
 	hashedToken := sha256.Sum256([]byte(plainTextToken))
 
 	query := `
-		SELECT u.id, u.first_name, u.last_name, u.email, u.role, u.created_at, u.updated_at
+		SELECT u.id, u.first_name, u.last_name, u.email, u.activated, u.role, u.created_at, u.updated_at
 		FROM users u
 		JOIN tokens t
 		ON u.id = t.user_id
@@ -69,9 +72,12 @@ func (t TokenModel) GetForToken(tokenScope, plainTextToken string) (*User, error
 
 	args := []any{hashedToken[:], tokenScope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "TokenModel.GetForToken", query)
+	defer span.End()
+
 	var user User
 
 	err := t.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -79,6 +85,7 @@ func (t TokenModel) GetForToken(tokenScope, plainTextToken string) (*User, error
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
+		&user.Activated,
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -88,26 +95,31 @@ func (t TokenModel) GetForToken(tokenScope, plainTextToken string) (*User, error
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, sql.ErrNoRows
 		default:
-			return nil, err
+			return nil, spanError(span, err)
 		}
 	}
 
+	spanRows(span, 1)
+
 	return &user, nil
 
 }
 
-func (t TokenModel) DeleteAllForUser(scope string, userID uuid.UUID) error {
+func (t TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID uuid.UUID) error {
 	query := `
 		DELETE FROM tokens
 		WHERE scope = $1 AND user_id = $2
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "TokenModel.DeleteAllForUser", query)
+	defer span.End()
+
 	_, err := t.DB.ExecContext(ctx, query, scope, userID)
 
-	return err
+	return spanError(span, err)
 
 }
 
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/kharljhon14/zentrix/internal/data")
+
+// startSpan starts a client span for a model method, tagged with the SQL
+// statement it is about to run.
+func startSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// spanRows records how many rows a statement returned or affected.
+func spanRows(span trace.Span, rows int) {
+	span.SetAttributes(semconv.DBResponseReturnedRows(rows))
+}
+
+// spanError marks the span as failed and returns err unchanged so it can
+// wrap a return value. sql.ErrNoRows is an expected outcome, not a failure.
+func spanError(span trace.Span, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		spanRows(span, 0)
+		return err
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	return err
+}
@@ -0,0 +1,323 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashEntities are the entity types that are soft-deleted into the trash,
+// in the order Purge deletes them so references go before what they refer
+// to.
+var TrashEntities = []string{"quotes", "projects", "contacts", "companies"}
+
+// purgeTimeout bounds each entity's purge.
+const purgeTimeout = time.Minute
+
+// trashEntity describes how an entity's deleted rows are listed, restored
+// and purged. Expressions use alias for the entity's table; owner is a
+// format string given the owner argument, matching rows that user owns as
+// Search defines it.
+type trashEntity struct {
+	table, alias    string
+	title, subtitle string
+	owner           string
+	// referenced matches rows that other rows still refer to, which Purge
+	// leaves until the references are gone.
+	referenced string
+	// parents are the records a row refers to, which must be out of the
+	// trash before the row can be restored.
+	parents []trashParent
+}
+
+// trashParent is a column referring to a record of entity.
+type trashParent struct {
+	entity, column string
+}
+
+// DeletedParentError is returned by TrashModel.Restore when the record
+// refers to one that is still in the trash.
+type DeletedParentError struct {
+	Entity string
+	ID     uuid.UUID
+}
+
+func (e *DeletedParentError) Error() string {
+	return fmt.Sprintf("%s %s is in the trash", e.Entity, e.ID)
+}
+
+var trashEntities = map[string]trashEntity{
+	"companies": {
+		table:    "companies",
+		alias:    "c",
+		title:    "c.name",
+		subtitle: "c.email",
+		owner:    "c.sales_owner = %[1]s",
+		referenced: `EXISTS (SELECT 1 FROM contacts WHERE company_id = c.id)
+			OR EXISTS (SELECT 1 FROM quotes WHERE company_id = c.id)
+			OR EXISTS (SELECT 1 FROM projects WHERE company_id = c.id)`,
+	},
+	"contacts": {
+		table:      "contacts",
+		alias:      "c",
+		title:      "c.name",
+		subtitle:   "c.email",
+		owner:      "EXISTS (SELECT 1 FROM companies o WHERE o.id = c.company_id AND o.sales_owner = %[1]s)",
+		referenced: "EXISTS (SELECT 1 FROM quotes WHERE prepared_for = c.id)",
+		parents:    []trashParent{{"companies", "company_id"}},
+	},
+	"quotes": {
+		table:      "quotes",
+		alias:      "q",
+		title:      "q.name",
+		subtitle:   "(SELECT name FROM companies WHERE id = q.company_id)",
+		owner:      "q.prepared_by = %[1]s",
+		referenced: "FALSE",
+		parents:    []trashParent{{"companies", "company_id"}, {"contacts", "prepared_for"}},
+	},
+	"projects": {
+		table:      "projects",
+		alias:      "p",
+		title:      "p.title",
+		subtitle:   "(SELECT name FROM companies WHERE id = p.company_id)",
+		owner:      "p.owner_id = %[1]s",
+		referenced: "FALSE",
+		parents:    []trashParent{{"companies", "company_id"}},
+	},
+}
+
+// TrashItem is a soft-deleted record of any of TrashEntities.
+type TrashItem struct {
+	Type      string     `json:"type"`
+	ID        uuid.UUID  `json:"id"`
+	Title     string     `json:"title"`
+	Subtitle  *string    `json:"subtitle"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+type TrashModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns a page of the deleted records of entities, most recently
+// deleted first. When owner is set, only records that user owns are
+// returned.
+func (m TrashModel) GetAll(ctx context.Context, entities []string, owner *uuid.UUID, filters Filters) ([]*TrashItem, Metadata, error) {
+	branches := make([]string, len(entities))
+	for i, name := range entities {
+		e := trashEntities[name]
+
+		branches[i] = fmt.Sprintf(`
+			SELECT '%s' AS type, %s.id, %s AS title, %s AS subtitle, %s.deleted_at
+			FROM %s %s
+			WHERE %s.deleted_at IS NOT NULL
+			AND ($1::uuid IS NULL OR %s)`,
+			name, e.alias, e.title, e.subtitle, e.alias,
+			e.table, e.alias,
+			e.alias,
+			fmt.Sprintf(e.owner, "$1::uuid"),
+		)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), type, id, title, subtitle, deleted_at
+		FROM (%s) t
+		ORDER BY deleted_at DESC, id
+		LIMIT $2 OFFSET $3
+	`, strings.Join(branches, "\n\t\t\tUNION ALL"))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TrashModel.GetAll", query)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query, owner, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*TrashItem{}
+
+	for rows.Next() {
+		var item TrashItem
+
+		err := rows.Scan(&totalRecords, &item.Type, &item.ID, &item.Title, &item.Subtitle, &item.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, spanError(span, err)
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, spanError(span, err)
+	}
+
+	spanRows(span, len(items))
+
+	return items, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Restore undeletes a record of entity. When owner is set the record must
+// be one that user owns. sql.ErrNoRows is returned if there is no such
+// deleted record, and a *DeletedParentError if it refers to a record that
+// is itself still in the trash, such as a contact of a deleted company.
+func (m TrashModel) Restore(ctx context.Context, entity string, ID uuid.UUID, owner *uuid.UUID) error {
+	e := trashEntities[entity]
+
+	query := fmt.Sprintf(`
+		UPDATE %s %s
+		SET deleted_at = NULL,
+		updated_at = NOW()
+		WHERE %s.id = $1 AND %s.deleted_at IS NOT NULL
+		AND ($2::uuid IS NULL OR %s)
+	`, e.table, e.alias, e.alias, e.alias, fmt.Sprintf(e.owner, "$2::uuid"))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TrashModel.Restore", query)
+	defer span.End()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	// A row can't come back while what it refers to is in the trash. The
+	// parents are locked so they can't be deleted while it does.
+	for _, parent := range e.parents {
+		parentQuery := fmt.Sprintf(`
+			SELECT parent.id, parent.deleted_at IS NOT NULL
+			FROM %s %s
+			JOIN %s parent ON parent.id = %s.%s
+			WHERE %s.id = $1 AND %s.deleted_at IS NOT NULL
+			AND ($2::uuid IS NULL OR %s)
+			FOR SHARE OF parent
+		`, e.table, e.alias, trashEntities[parent.entity].table, e.alias, parent.column,
+			e.alias, e.alias, fmt.Sprintf(e.owner, "$2::uuid"))
+
+		var parentID uuid.UUID
+		var parentDeleted bool
+
+		err := tx.QueryRowContext(ctx, parentQuery, ID, owner).Scan(&parentID, &parentDeleted)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			continue
+		case err != nil:
+			return spanError(span, err)
+		case parentDeleted:
+			return &DeletedParentError{Entity: parent.entity, ID: parentID}
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, query, ID, owner)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err = tx.Commit(); err != nil {
+		return spanError(span, err)
+	}
+
+	return nil
+}
+
+// Purge permanently deletes the records deleted before cutoff and returns
+// how many of each entity went. Records that live rows still refer to,
+// such as a deleted company with contacts, are kept until they no longer
+// are. A quote's products go with it, and reference custom fields
+// pointing at a purged record are removed.
+func (m TrashModel) Purge(ctx context.Context, cutoff time.Time) (map[string]int, error) {
+	purged := make(map[string]int, len(TrashEntities))
+
+	for _, name := range TrashEntities {
+		e := trashEntities[name]
+
+		query := fmt.Sprintf(`
+			DELETE FROM %s %s
+			WHERE %s.deleted_at < $1
+			AND NOT (%s)
+			RETURNING %s.id
+		`, e.table, e.alias, e.alias, e.referenced, e.alias)
+
+		n, err := m.purge(ctx, name, query, cutoff)
+		if err != nil {
+			return purged, err
+		}
+
+		purged[name] = n
+	}
+
+	return purged, nil
+}
+
+func (m TrashModel) purge(ctx context.Context, entity, query string, cutoff time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, purgeTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "TrashModel.Purge", query)
+	defer span.End()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+
+	var IDs []uuid.UUID
+	for rows.Next() {
+		var ID uuid.UUID
+		if err := rows.Scan(&ID); err != nil {
+			rows.Close()
+			return 0, spanError(span, err)
+		}
+		IDs = append(IDs, ID)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, spanError(span, err)
+	}
+
+	if len(IDs) > 0 {
+		_, err = repointReferences(ctx, tx, entity, IDs, nil)
+		if err != nil {
+			return 0, spanError(span, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, spanError(span, err)
+	}
+
+	spanRows(span, len(IDs))
+
+	return len(IDs), nil
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// testDB connects to the migrated database in ZENTRIX_TEST_DSN, skipping
+// the test when it isn't set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("ZENTRIX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ZENTRIX_TEST_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestTrashRestoreDeletedParent(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	suffix := uuid.NewString()
+
+	var userID, companyID, contactID uuid.UUID
+
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO users (first_name, last_name, email, password_hash, role)
+		VALUES ('Trash', 'Test', $1, 'x', 'user')
+		RETURNING id`, "trash-"+suffix+"@example.test").Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", userID) })
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO companies (name, address, sales_owner, email, company_size, industry, business_type, country, deleted_at)
+		VALUES ('Acme', 'Main St', $1, $2, '1-10', 'SaaS', 'B2B', 'PH', now())
+		RETURNING id`, userID, "acme-"+suffix+"@example.test").Scan(&companyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM companies WHERE id = $1", companyID) })
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO contacts (name, email, company_id, title, status, deleted_at)
+		VALUES ('Jane', $1, $2, 'CTO', 'Lead', now())
+		RETURNING id`, "jane-"+suffix+"@example.test", companyID).Scan(&contactID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM contacts WHERE id = $1", contactID) })
+
+	m := TrashModel{DB: db}
+
+	var parentErr *DeletedParentError
+	err = m.Restore(ctx, "contacts", contactID, nil)
+	if !errors.As(err, &parentErr) {
+		t.Fatalf("restoring the contact: got %v, want a DeletedParentError", err)
+	}
+	if parentErr.Entity != "companies" || parentErr.ID != companyID {
+		t.Errorf("got parent %s %s, want companies %s", parentErr.Entity, parentErr.ID, companyID)
+	}
+
+	var deleted bool
+	err = db.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM contacts WHERE id = $1", contactID).Scan(&deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Error("contact was restored although its company is in the trash")
+	}
+
+	if err := m.Restore(ctx, "companies", companyID, nil); err != nil {
+		t.Fatalf("restoring the company: %v", err)
+	}
+
+	if err := m.Restore(ctx, "contacts", contactID, nil); err != nil {
+		t.Fatalf("restoring the contact after its company: %v", err)
+	}
+}
@@ -13,21 +13,33 @@ import (
 
 type User struct {
 	ID        uuid.UUID `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
+	FirstName string    `json:"first_name" validate:"required,max=80"`
+	LastName  string    `json:"last_name" validate:"required,max=80"`
+	Email     string    `json:"email" validate:"required,max=255,email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Role      string    `json:"role"`
+	Role      string    `json:"role" validate:"required,max=60"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// RoleAdmin can see every record. Other roles only see what they own.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
 type UserModel struct {
 	DB *sql.DB
 }
 
-func (u UserModel) Insert(user *User) error {
+func (u UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
 		INSERT INTO USERS (first_name, last_name, email, password_hash, role)
 		VALUES ($1, $2, $3, $4, $5)
@@ -42,9 +54,12 @@ func (u UserModel) Insert(user *User) error {
 		user.Role,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "UserModel.Insert", query)
+	defer span.End()
+
 	err := u.DB.QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.CreatedAt,
@@ -55,14 +70,16 @@ func (u UserModel) Insert(user *User) error {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
+	spanRows(span, 1)
+
 	return nil
 }
 
-func (u UserModel) Update(user *User) error {
+func (u UserModel) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
 		SET first_name = $1,
@@ -76,9 +93,12 @@ func (u UserModel) Update(user *User) error {
 
 	args := []any{user.FirstName, user.LastName, user.Email, user.Activated, user.Role}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "UserModel.Update", query)
+	defer span.End()
+
 	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.UpdatedAt)
 	if err != nil {
 		switch {
@@ -87,14 +107,16 @@ func (u UserModel) Update(user *User) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return sql.ErrNoRows
 		default:
-			return err
+			return spanError(span, err)
 		}
 	}
 
+	spanRows(span, 1)
+
 	return nil
 }
 
-func (u UserModel) GetByID(ID uuid.UUID) (*User, error) {
+func (u UserModel) GetByID(ctx context.Context, ID uuid.UUID) (*User, error) {
 	query := `
 		SELECT 
 			id,
@@ -109,9 +131,12 @@ func (u UserModel) GetByID(ID uuid.UUID) (*User, error) {
 		WHERE id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
+	ctx, span := startSpan(ctx, "UserModel.GetByID", query)
+	defer span.End()
+
 	var user User
 	err := u.DB.QueryRowContext(ctx, query, ID).Scan(
 		&user.ID,
@@ -124,16 +149,95 @@ func (u UserModel) GetByID(ID uuid.UUID) (*User, error) {
 		&user.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
+	spanRows(span, 1)
+
 	return &user, nil
 
 }
 
+// Promote makes the user with email an admin. sql.ErrNoRows is returned if
+// there is no such user.
+func (u UserModel) Promote(ctx context.Context, email string) error {
+	query := `
+		UPDATE users
+		SET role = $1, updated_at = NOW()
+		WHERE lower(email) = lower($2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "UserModel.Promote", query)
+	defer span.End()
+
+	result, err := u.DB.ExecContext(ctx, query, RoleAdmin, email)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (u UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT 
+			id,
+			first_name,
+			last_name,
+			email,
+			password_hash,
+			activated,
+			role,
+			created_at,
+			updated_at
+		FROM USERS
+		WHERE email = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "UserModel.GetByEmail", query)
+	defer span.End()
+
+	var user User
+	err := u.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return &user, nil
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "email is required")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "invalid email")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "email must be a valid email address")
 }
 
 func ValidatePassword(v *validator.Validator, password string) {
@@ -144,16 +248,7 @@ func ValidatePassword(v *validator.Validator, password string) {
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.FirstName != "", "first_name", "first_name is required")
-	v.Check(len(user.FirstName) <= 80, "first_name", "first_name must not exceed 80 characters")
-
-	v.Check(user.LastName != "", "last_name", "last_name is required")
-	v.Check(len(user.LastName) <= 80, "last_name", "last_name must not exceed 80 characters")
-
-	v.Check(user.Role != "", "role", "role is required")
-	v.Check(len(user.Role) <= 60, "role", "role must not exceed 40 characters")
-
-	ValidateEmail(v, user.Email)
+	v.Struct(user)
 
 	if user.Password.plainText != nil {
 		ValidatePassword(v, *user.Password.plainText)
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/kharljhon14/zentrix/internal/validator"
+)
+
+// SavedView is a named set of list parameters, such as "my open quotes
+// in Negotiation". Filters use the list endpoints' query syntax, so "me"
+// is resolved for whoever applies the view.
+type SavedView struct {
+	ID        uuid.UUID           `json:"id"`
+	OwnerID   uuid.UUID           `json:"owner_id"`
+	Entity    string              `json:"entity" validate:"required,oneof=companies contacts quotes"`
+	Name      string              `json:"name" validate:"required,max=255"`
+	Filters   map[string][]string `json:"filters"`
+	Sort      string              `json:"sort" validate:"max=64"`
+	Search    string              `json:"q" validate:"max=200"`
+	Columns   []string            `json:"columns" validate:"max=50"`
+	Shared    bool                `json:"shared"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+func (s SavedView) ValidateSavedView(v *validator.Validator) {
+	v.Struct(s)
+
+	for _, column := range s.Columns {
+		if column == "" || len(column) > 64 {
+			v.AddError("columns", "must only contain names of 1 to 64 bytes")
+			break
+		}
+	}
+}
+
+// Query returns the view as list query parameters.
+func (s SavedView) Query() url.Values {
+	qs := make(url.Values, len(s.Filters)+3)
+	for key, values := range s.Filters {
+		qs[key] = append([]string(nil), values...)
+	}
+
+	if s.Sort != "" {
+		qs.Set("sort", s.Sort)
+	}
+	if s.Search != "" {
+		qs.Set("q", s.Search)
+	}
+	if len(s.Columns) > 0 {
+		qs.Set("columns", strings.Join(s.Columns, ","))
+	}
+
+	return qs
+}
+
+// VisibleTo reports whether user may see and apply the view.
+func (s SavedView) VisibleTo(user *User) bool {
+	return s.Shared || s.OwnerID == user.ID && !user.IsAnonymous()
+}
+
+// EditableBy reports whether user may change or delete the view.
+func (s SavedView) EditableBy(user *User) bool {
+	return !user.IsAnonymous() && (s.OwnerID == user.ID || user.Role == RoleAdmin)
+}
+
+type SavedViewModel struct {
+	DB *sql.DB
+}
+
+func (m SavedViewModel) Insert(ctx context.Context, view *SavedView) error {
+	query := `
+		INSERT INTO saved_views
+		(owner_id, entity, name, filters, sort, search, columns, shared)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	filters, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		view.OwnerID,
+		view.Entity,
+		view.Name,
+		filters,
+		view.Sort,
+		view.Search,
+		pq.Array(view.Columns),
+		view.Shared,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SavedViewModel.Insert", query)
+	defer span.End()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&view.ID, &view.CreatedAt, &view.UpdatedAt)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+const savedViewColumns = `
+	id, owner_id, entity, name, filters, sort, search, columns, shared, created_at, updated_at
+`
+
+func scanSavedView(row interface{ Scan(...any) error }) (*SavedView, error) {
+	var view SavedView
+	var filters []byte
+
+	err := row.Scan(
+		&view.ID,
+		&view.OwnerID,
+		&view.Entity,
+		&view.Name,
+		&filters,
+		&view.Sort,
+		&view.Search,
+		pq.Array(&view.Columns),
+		&view.Shared,
+		&view.CreatedAt,
+		&view.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(filters, &view.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &view, nil
+}
+
+func (m SavedViewModel) GetByID(ctx context.Context, ID uuid.UUID) (*SavedView, error) {
+	query := `SELECT ` + savedViewColumns + ` FROM saved_views WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SavedViewModel.GetByID", query)
+	defer span.End()
+
+	view, err := scanSavedView(m.DB.QueryRowContext(ctx, query, ID))
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return view, nil
+}
+
+// GetAllVisible returns the views user owns plus those shared with the
+// team, optionally only for entity, ordered by name.
+func (m SavedViewModel) GetAllVisible(ctx context.Context, userID uuid.UUID, entity string) ([]*SavedView, error) {
+	query := `
+		SELECT ` + savedViewColumns + `
+		FROM saved_views
+		WHERE (owner_id = $1 OR shared)
+		AND ($2 = '' OR entity = $2)
+		ORDER BY lower(name), id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SavedViewModel.GetAllVisible", query)
+	defer span.End()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, entity)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+	defer rows.Close()
+
+	views := []*SavedView{}
+	for rows.Next() {
+		view, err := scanSavedView(rows)
+		if err != nil {
+			return nil, spanError(span, err)
+		}
+
+		views = append(views, view)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	spanRows(span, len(views))
+
+	return views, nil
+}
+
+func (m SavedViewModel) Update(ctx context.Context, view *SavedView) error {
+	query := `
+		UPDATE saved_views
+		SET name = $1,
+		filters = $2,
+		sort = $3,
+		search = $4,
+		columns = $5,
+		shared = $6,
+		updated_at = NOW()
+		WHERE id = $7
+		RETURNING updated_at
+	`
+
+	filters, err := json.Marshal(view.Filters)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		view.Name,
+		filters,
+		view.Sort,
+		view.Search,
+		pq.Array(view.Columns),
+		view.Shared,
+		view.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SavedViewModel.Update", query)
+	defer span.End()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&view.UpdatedAt)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, 1)
+
+	return nil
+}
+
+func (m SavedViewModel) Delete(ctx context.Context, ID uuid.UUID) error {
+	query := `DELETE FROM saved_views WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "SavedViewModel.Delete", query)
+	defer span.End()
+
+	rows, err := m.DB.ExecContext(ctx, query, ID)
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	affected, err := rows.RowsAffected()
+	if err != nil {
+		return spanError(span, err)
+	}
+
+	spanRows(span, int(affected))
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_companies_created_at_id;
+DROP INDEX IF EXISTS idx_contacts_created_at_id;
+DROP INDEX IF EXISTS idx_quotes_created_at_id;
@@ -0,0 +1,5 @@
+-- Keyset pagination orders by (sort column, id). These cover the default
+-- -created_at sort so deep pages are an index range scan.
+CREATE INDEX IF NOT EXISTS idx_companies_created_at_id ON companies(created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_contacts_created_at_id ON contacts(created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_quotes_created_at_id ON quotes(created_at, id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_contacts_name_trgm;
+DROP INDEX IF EXISTS idx_contacts_search;
+ALTER TABLE contacts DROP COLUMN IF EXISTS "search";
+
+DROP INDEX IF EXISTS idx_companies_name_trgm;
+DROP INDEX IF EXISTS idx_companies_search;
+ALTER TABLE companies DROP COLUMN IF EXISTS "search";
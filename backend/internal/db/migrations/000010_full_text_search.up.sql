@@ -0,0 +1,25 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The 'simple' configuration doesn't stem, which suits names. Email and
+-- website punctuation is turned into spaces so "acme" matches
+-- info@acme.com and https://acme.com.
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS "search" TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', translate(coalesce(email, ''), '@.', '  ')), 'B') ||
+        setweight(to_tsvector('simple', translate(coalesce(website, ''), ':/.', '   ')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(industry, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_companies_search ON companies USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_companies_name_trgm ON companies USING GIN (name gin_trgm_ops);
+
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS "search" TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', translate(coalesce(email, ''), '@.', '  ')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(title, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_contacts_search ON contacts USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_contacts_name_trgm ON contacts USING GIN (name gin_trgm_ops);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_projects_owner_id;
+DROP INDEX IF EXISTS idx_quotes_prepared_by;
+DROP INDEX IF EXISTS idx_companies_sales_owner;
+
+DROP INDEX IF EXISTS idx_projects_title_trgm;
+DROP INDEX IF EXISTS idx_projects_search;
+ALTER TABLE projects DROP COLUMN IF EXISTS "search";
+
+DROP INDEX IF EXISTS idx_quotes_name_trgm;
+DROP INDEX IF EXISTS idx_quotes_search;
+ALTER TABLE quotes DROP COLUMN IF EXISTS "search";
@@ -0,0 +1,22 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS "search" TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(stage, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_quotes_search ON quotes USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_quotes_name_trgm ON quotes USING GIN (name gin_trgm_ops);
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS "search" TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(description, '')), 'D')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_projects_search ON projects USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_projects_title_trgm ON projects USING GIN (title gin_trgm_ops);
+
+-- Owner scoping for non-admin searches.
+CREATE INDEX IF NOT EXISTS idx_companies_sales_owner ON companies(sales_owner);
+CREATE INDEX IF NOT EXISTS idx_quotes_prepared_by ON quotes(prepared_by);
+CREATE INDEX IF NOT EXISTS idx_projects_owner_id ON projects(owner_id);
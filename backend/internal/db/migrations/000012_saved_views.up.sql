@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS "saved_views" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "owner_id" UUID NOT NULL,
+    "entity" VARCHAR(32) NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "filters" JSONB NOT NULL DEFAULT '{}',
+    "sort" VARCHAR(64) NOT NULL DEFAULT '',
+    "search" VARCHAR(200) NOT NULL DEFAULT '',
+    "columns" TEXT[] NOT NULL DEFAULT '{}',
+    "shared" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT fk_owner_id
+        FOREIGN KEY ("owner_id") REFERENCES "users"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_views_owner_entity ON saved_views(owner_id, entity);
+CREATE INDEX IF NOT EXISTS idx_saved_views_shared_entity ON saved_views(entity) WHERE shared;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS "import_jobs" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "owner_id" UUID NOT NULL,
+    "entity" VARCHAR(32) NOT NULL,
+    "status" VARCHAR(16) NOT NULL DEFAULT 'pending',
+    "dry_run" BOOLEAN NOT NULL DEFAULT FALSE,
+    "total_rows" INTEGER NOT NULL DEFAULT 0,
+    "processed_rows" INTEGER NOT NULL DEFAULT 0,
+    "created_rows" INTEGER NOT NULL DEFAULT 0,
+    "updated_rows" INTEGER NOT NULL DEFAULT 0,
+    "failed_rows" INTEGER NOT NULL DEFAULT 0,
+    "errors" JSONB NOT NULL DEFAULT '[]',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "finished_at" TIMESTAMPTZ DEFAULT NULL,
+
+    CONSTRAINT fk_owner_id
+        FOREIGN KEY ("owner_id") REFERENCES "users"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_owner_id ON import_jobs(owner_id, created_at);
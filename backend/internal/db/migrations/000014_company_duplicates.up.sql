@@ -0,0 +1,37 @@
+-- Candidate duplicate companies found by the detection job. company_id is
+-- the older of the pair, the suggested survivor of a merge.
+CREATE TABLE IF NOT EXISTS "company_duplicates" (
+    "company_id" UUID NOT NULL,
+    "duplicate_id" UUID NOT NULL,
+    "score" REAL NOT NULL,
+    "name_similarity" REAL NOT NULL,
+    "same_domain" BOOLEAN NOT NULL,
+    "address_similarity" REAL NOT NULL,
+    "detected_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY ("company_id", "duplicate_id"),
+
+    CONSTRAINT fk_company_id
+        FOREIGN KEY ("company_id") REFERENCES "companies"(id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_duplicate_id
+        FOREIGN KEY ("duplicate_id") REFERENCES "companies"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_duplicates_duplicate_id ON company_duplicates(duplicate_id);
+CREATE INDEX IF NOT EXISTS idx_company_duplicates_score ON company_duplicates(score DESC);
+
+CREATE TABLE IF NOT EXISTS "audit_log" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "actor_id" UUID,
+    "action" VARCHAR(64) NOT NULL,
+    "entity" VARCHAR(32) NOT NULL,
+    "entity_id" UUID NOT NULL,
+    "details" JSONB NOT NULL DEFAULT '{}',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT fk_actor_id
+        FOREIGN KEY ("actor_id") REFERENCES "users"(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id, created_at);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_projects_company_id_fk;
+DROP INDEX IF EXISTS idx_quotes_prepared_for;
+DROP INDEX IF EXISTS idx_quotes_company_id;
+
+DROP INDEX IF EXISTS idx_quotes_created_at_id;
+CREATE INDEX IF NOT EXISTS idx_quotes_created_at_id ON quotes(created_at, id);
+
+DROP INDEX IF EXISTS idx_projects_deleted_at;
+DROP INDEX IF EXISTS idx_quotes_deleted_at;
+DROP INDEX IF EXISTS idx_contacts_deleted_at;
+DROP INDEX IF EXISTS idx_companies_deleted_at;
+
+ALTER TABLE projects DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE quotes DROP COLUMN IF EXISTS deleted_at;
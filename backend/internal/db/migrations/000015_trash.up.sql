@@ -0,0 +1,18 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ DEFAULT NULL;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMPTZ DEFAULT NULL;
+
+-- The trash lists and purges by deletion time, and only ever looks at
+-- deleted rows.
+CREATE INDEX IF NOT EXISTS idx_companies_deleted_at ON companies(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_contacts_deleted_at ON contacts(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_quotes_deleted_at ON quotes(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Quotes now soft delete, so keyset paging only covers the live ones.
+DROP INDEX IF EXISTS idx_quotes_created_at_id;
+CREATE INDEX IF NOT EXISTS idx_quotes_created_at_id ON quotes(created_at, id) WHERE deleted_at IS NULL;
+
+-- Purging checks for rows still pointing at a deleted record.
+CREATE INDEX IF NOT EXISTS idx_quotes_company_id ON quotes(company_id);
+CREATE INDEX IF NOT EXISTS idx_quotes_prepared_for ON quotes(prepared_for);
+CREATE INDEX IF NOT EXISTS idx_projects_company_id_fk ON projects(company_id);
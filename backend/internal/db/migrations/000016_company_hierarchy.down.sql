@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_companies_parent_id;
+
+ALTER TABLE companies DROP CONSTRAINT IF EXISTS companies_parent_id_check;
+ALTER TABLE companies DROP CONSTRAINT IF EXISTS companies_parent_id_fkey;
+ALTER TABLE companies DROP COLUMN IF EXISTS parent_id;
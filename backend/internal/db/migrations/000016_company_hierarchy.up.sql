@@ -0,0 +1,12 @@
+-- A company may belong to a parent company, forming groups of
+-- subsidiaries. Cycles are refused by the application.
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS "parent_id" UUID DEFAULT NULL;
+
+ALTER TABLE companies ADD CONSTRAINT companies_parent_id_fkey
+    FOREIGN KEY ("parent_id") REFERENCES "companies"(id) ON DELETE SET NULL;
+
+ALTER TABLE companies ADD CONSTRAINT companies_parent_id_check
+    CHECK ("parent_id" <> "id");
+
+-- Trees and ?include_subsidiaries= walk down from a company.
+CREATE INDEX IF NOT EXISTS idx_companies_parent_id ON companies(parent_id) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS project_tags;
+DROP TABLE IF EXISTS quote_tags;
+DROP TABLE IF EXISTS contact_tags;
+DROP TABLE IF EXISTS company_tags;
+
+DROP INDEX IF EXISTS tags_name_key;
+DROP TABLE IF EXISTS tags;
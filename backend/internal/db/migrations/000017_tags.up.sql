@@ -0,0 +1,76 @@
+-- Tags classify records across entities, e.g. "VIP" or "Q4 push". Names
+-- are unique regardless of case.
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "name" VARCHAR(50) NOT NULL,
+    "color" CHAR(7) NOT NULL DEFAULT '#6b7280',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Also serves autocomplete, which matches name prefixes.
+CREATE UNIQUE INDEX IF NOT EXISTS tags_name_key ON tags(lower(name) text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS "company_tags" (
+    "company_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY ("company_id", "tag_id"),
+
+    CONSTRAINT fk_company_id
+        FOREIGN KEY ("company_id") REFERENCES "companies"(id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_tag_id
+        FOREIGN KEY ("tag_id") REFERENCES "tags"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_tags_tag_id ON company_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS "contact_tags" (
+    "contact_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY ("contact_id", "tag_id"),
+
+    CONSTRAINT fk_contact_id
+        FOREIGN KEY ("contact_id") REFERENCES "contacts"(id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_tag_id
+        FOREIGN KEY ("tag_id") REFERENCES "tags"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_tags_tag_id ON contact_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS "quote_tags" (
+    "quote_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY ("quote_id", "tag_id"),
+
+    CONSTRAINT fk_quote_id
+        FOREIGN KEY ("quote_id") REFERENCES "quotes"(id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_tag_id
+        FOREIGN KEY ("tag_id") REFERENCES "tags"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_quote_tags_tag_id ON quote_tags(tag_id);
+
+CREATE TABLE IF NOT EXISTS "project_tags" (
+    "project_id" UUID NOT NULL,
+    "tag_id" UUID NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY ("project_id", "tag_id"),
+
+    CONSTRAINT fk_project_id
+        FOREIGN KEY ("project_id") REFERENCES "projects"(id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_tag_id
+        FOREIGN KEY ("tag_id") REFERENCES "tags"(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_tags_tag_id ON project_tags(tag_id);
@@ -0,0 +1,5 @@
+ALTER TABLE quotes DROP COLUMN IF EXISTS "custom_fields";
+ALTER TABLE contacts DROP COLUMN IF EXISTS "custom_fields";
+ALTER TABLE companies DROP COLUMN IF EXISTS "custom_fields";
+
+DROP TABLE IF EXISTS "custom_fields";
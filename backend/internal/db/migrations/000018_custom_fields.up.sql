@@ -0,0 +1,29 @@
+-- Custom fields are extra fields admins define per entity, e.g. a contract
+-- renewal date on companies. Their values live in each record's
+-- custom_fields column, keyed by the definition's key.
+CREATE TABLE IF NOT EXISTS "custom_fields" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "entity" VARCHAR(20) NOT NULL,
+    "key" VARCHAR(50) NOT NULL,
+    "label" VARCHAR(255) NOT NULL,
+    "type" VARCHAR(20) NOT NULL,
+    -- The choices of an enum field.
+    "options" TEXT[] NOT NULL DEFAULT '{}',
+    -- The entity a reference field points at.
+    "reference" VARCHAR(20) NOT NULL DEFAULT '',
+    "required" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT custom_fields_entity_key_key UNIQUE ("entity", "key"),
+
+    CONSTRAINT custom_fields_entity_check
+        CHECK ("entity" IN ('companies', 'contacts', 'quotes')),
+
+    CONSTRAINT custom_fields_type_check
+        CHECK ("type" IN ('text', 'number', 'date', 'enum', 'boolean', 'reference'))
+);
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS "custom_fields" JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS "custom_fields" JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS "custom_fields" JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+-- Every user used to be registered as an admin. Keep the first user of
+-- the install as the admin and demote the rest; operators can choose a
+-- different admin with the admin-email setting.
+UPDATE users
+SET role = 'user', updated_at = NOW()
+WHERE role = 'admin'
+AND id <> (SELECT id FROM users ORDER BY created_at, id LIMIT 1);
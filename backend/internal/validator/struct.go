@@ -0,0 +1,299 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Rule checks a single value against the tag parameter (the part after
+// "=" in max=255) and returns a message describing the failure, or "" if
+// the value is valid. The message is prefixed with the field name, e.g.
+// "must not exceed 255 characters" becomes "name must not exceed 255
+// characters".
+type Rule func(value reflect.Value, param string) string
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"max":   ruleMax,
+		"min":   ruleMin,
+		"email": ruleEmail,
+		"uuid":  ruleUUID,
+		"oneof": ruleOneOf,
+	}
+)
+
+// RegisterRule makes a custom rule available to validate tags under name.
+// It is meant to be called from init functions and panics if name is
+// already taken.
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if _, exists := rules[name]; exists || name == "required" {
+		panic("validator: rule already registered: " + name)
+	}
+
+	rules[name] = rule
+}
+
+var uuidType = reflect.TypeFor[uuid.UUID]()
+
+// Struct validates s using the `validate` tags on its fields, for example
+//
+//	Name string `json:"name" validate:"required,max=255"`
+//
+// Errors are keyed by the field's JSON name. Nested structs and slices of
+// structs are validated recursively, producing keys such as
+// "products[2].unit_price". Fields that are absent (nil pointers and empty
+// strings, slices and maps) and not required skip the remaining rules; a
+// zero number is still checked.
+func (v Validator) Struct(s any) {
+	v.Value("", s)
+}
+
+// Value validates value as if it were found at path, so that
+//
+//	v.Value("products", products)
+//
+// reports errors under "products[0].title" and so on.
+func (v Validator) Value(path string, value any) {
+	v.walk(path, reflect.ValueOf(value))
+}
+
+func (v Validator) walk(path string, rv reflect.Value) {
+	if !rv.IsValid() {
+		return
+	}
+
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Type() == uuidType {
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, ok := jsonName(field)
+			if !ok {
+				continue
+			}
+
+			fieldPath := name
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				fieldPath = path
+			} else if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			fv := rv.Field(i)
+
+			if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+				if !v.checkTag(fieldPath, leaf(fieldPath), fv, tag) {
+					continue
+				}
+			}
+
+			v.walk(fieldPath, fv)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			v.walk(fmt.Sprintf("%s[%d]", path, i), rv.Index(i))
+		}
+	}
+}
+
+// checkTag applies the comma separated rules in tag to fv and reports
+// whether fv is worth descending into.
+func (v Validator) checkTag(path, name string, fv reflect.Value, tag string) bool {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	for _, spec := range strings.Split(tag, ",") {
+		ruleName, param, _ := strings.Cut(strings.TrimSpace(spec), "=")
+
+		if ruleName == "required" {
+			if isEmpty(fv) {
+				v.AddError(path, name+" is required")
+				return false
+			}
+			continue
+		}
+
+		if isAbsent(fv) {
+			return false
+		}
+
+		rule, ok := rules[ruleName]
+		if !ok {
+			panic("validator: unknown rule " + ruleName + " on " + path)
+		}
+
+		if msg := rule(indirect(fv), param); msg != "" {
+			v.AddError(path, name+" "+msg)
+			return false
+		}
+	}
+
+	return true
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, true
+}
+
+func leaf(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.String:
+		return isAbsent(rv)
+	}
+
+	return rv.IsZero()
+}
+
+// isAbsent reports whether rv was left out of the input, as opposed to
+// being set to its zero value.
+func isAbsent(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	case reflect.String:
+		return strings.TrimSpace(rv.String()) == ""
+	}
+
+	return false
+}
+
+func ruleMax(rv reflect.Value, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validator: invalid max parameter " + param)
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		if float64(utf8.RuneCountInString(rv.String())) > limit {
+			return fmt.Sprintf("must not exceed %s characters", param)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if float64(rv.Len()) > limit {
+			return fmt.Sprintf("must not contain more than %s items", param)
+		}
+	default:
+		if n, ok := number(rv); ok && n > limit {
+			return fmt.Sprintf("must not exceed %s", param)
+		}
+	}
+
+	return ""
+}
+
+func ruleMin(rv reflect.Value, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validator: invalid min parameter " + param)
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		if float64(utf8.RuneCountInString(rv.String())) < limit {
+			return fmt.Sprintf("must be at least %s characters", param)
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if float64(rv.Len()) < limit {
+			return fmt.Sprintf("must contain at least %s items", param)
+		}
+	default:
+		if n, ok := number(rv); ok && n < limit {
+			return fmt.Sprintf("must be at least %s", param)
+		}
+	}
+
+	return ""
+}
+
+func ruleEmail(rv reflect.Value, _ string) string {
+	if rv.Kind() != reflect.String || !Matches(rv.String(), EmailRX) {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func ruleUUID(rv reflect.Value, _ string) string {
+	switch {
+	case rv.Type() == uuidType:
+		if rv.Interface().(uuid.UUID) == uuid.Nil {
+			return "must be a valid ID"
+		}
+	case rv.Kind() == reflect.String:
+		if uuid.Validate(rv.String()) != nil {
+			return "must be a valid ID"
+		}
+	}
+	return ""
+}
+
+func ruleOneOf(rv reflect.Value, param string) string {
+	options := strings.Fields(param)
+	if !PermittedValues(fmt.Sprint(rv.Interface()), options...) {
+		return "must be one of: " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+func number(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,233 @@
+package validator
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type testProduct struct {
+	Title     string `json:"title" validate:"required,max=10"`
+	UnitPrice int    `json:"unit_price" validate:"min=0"`
+}
+
+type testQuote struct {
+	ID       uuid.UUID     `json:"id"`
+	OwnerID  uuid.UUID     `json:"owner_id" validate:"uuid"`
+	Company  string        `json:"company_id" validate:"uuid"`
+	Contact  *string       `json:"contact_id" validate:"uuid"`
+	Version  int           `json:"version" validate:"min=1"`
+	Name     string        `json:"name" validate:"required,max=5"`
+	Email    string        `json:"email" validate:"email"`
+	Stage    string        `json:"stage" validate:"oneof=New Won Lost"`
+	SalesTax int           `json:"sales_tax" validate:"max=100"`
+	Notes    *string       `json:"notes" validate:"min=3"`
+	Tags     []string      `json:"tags" validate:"max=2"`
+	Products []testProduct `json:"products" validate:"min=1"`
+	Secret   string        `json:"-" validate:"required"`
+}
+
+func validQuote() testQuote {
+	return testQuote{
+		Name:     "Acme",
+		Email:    "sales@acme.test",
+		Stage:    "New",
+		OwnerID:  uuid.New(),
+		SalesTax: 12,
+		Version:  1,
+		Products: []testProduct{{Title: "Widget", UnitPrice: 5}},
+	}
+}
+
+func TestStruct(t *testing.T) {
+	short := "ok"
+	blank := ""
+
+	tests := []struct {
+		name   string
+		modify func(q *testQuote)
+		want   map[string]string
+	}{
+		{
+			name:   "valid",
+			modify: func(q *testQuote) {},
+			want:   map[string]string{},
+		},
+		{
+			name:   "required missing",
+			modify: func(q *testQuote) { q.Name = "" },
+			want:   map[string]string{"name": "name is required"},
+		},
+		{
+			name:   "required blank",
+			modify: func(q *testQuote) { q.Name = "   " },
+			want:   map[string]string{"name": "name is required"},
+		},
+		{
+			name:   "max string counts characters",
+			modify: func(q *testQuote) { q.Name = "Ächmé" },
+			want:   map[string]string{},
+		},
+		{
+			name:   "max string",
+			modify: func(q *testQuote) { q.Name = "Acme Inc" },
+			want:   map[string]string{"name": "name must not exceed 5 characters"},
+		},
+		{
+			name:   "max number",
+			modify: func(q *testQuote) { q.SalesTax = 101 },
+			want:   map[string]string{"sales_tax": "sales_tax must not exceed 100"},
+		},
+		{
+			name:   "max slice",
+			modify: func(q *testQuote) { q.Tags = []string{"a", "b", "c"} },
+			want:   map[string]string{"tags": "tags must not contain more than 2 items"},
+		},
+		{
+			name:   "min pointer",
+			modify: func(q *testQuote) { q.Notes = &short },
+			want:   map[string]string{"notes": "notes must be at least 3 characters"},
+		},
+		{
+			name:   "empty slice skips min",
+			modify: func(q *testQuote) { q.Products = nil },
+			want:   map[string]string{},
+		},
+		{
+			name:   "email",
+			modify: func(q *testQuote) { q.Email = "not an email" },
+			want:   map[string]string{"email": "email must be a valid email address"},
+		},
+		{
+			name:   "empty optional fields skip their rules",
+			modify: func(q *testQuote) { q.Email, q.Stage = "", "" },
+			want:   map[string]string{},
+		},
+		{
+			name:   "oneof",
+			modify: func(q *testQuote) { q.Stage = "Pending" },
+			want:   map[string]string{"stage": "stage must be one of: New, Won, Lost"},
+		},
+		{
+			name:   "zero number is not absent",
+			modify: func(q *testQuote) { q.Version = 0 },
+			want:   map[string]string{"version": "version must be at least 1"},
+		},
+		{
+			name:   "uuid string",
+			modify: func(q *testQuote) { q.Company = "not-a-uuid" },
+			want:   map[string]string{"company_id": "company_id must be a valid ID"},
+		},
+		{
+			name:   "uuid nil",
+			modify: func(q *testQuote) { q.OwnerID = uuid.Nil },
+			want:   map[string]string{"owner_id": "owner_id must be a valid ID"},
+		},
+		{
+			name:   "uuid pointer to empty string",
+			modify: func(q *testQuote) { q.Contact = &blank },
+			want:   map[string]string{"contact_id": "contact_id must be a valid ID"},
+		},
+		{
+			name: "nested paths",
+			modify: func(q *testQuote) {
+				q.Products = append(q.Products,
+					testProduct{Title: "Gadget", UnitPrice: 1},
+					testProduct{Title: "", UnitPrice: -1},
+				)
+			},
+			want: map[string]string{
+				"products[2].title":      "title is required",
+				"products[2].unit_price": "unit_price must be at least 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := validQuote()
+			tt.modify(&q)
+
+			v := New()
+			v.Struct(&q)
+
+			if !maps.Equal(v.Errors, tt.want) {
+				t.Errorf("got errors %v, want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	v := New()
+	v.Value("products", []testProduct{{Title: "Widget"}, {Title: "A very long title"}})
+
+	want := map[string]string{"products[1].title": "title must not exceed 10 characters"}
+	if !maps.Equal(v.Errors, want) {
+		t.Errorf("got errors %v, want %v", v.Errors, want)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("even", func(value reflect.Value, _ string) string {
+		if value.Int()%2 != 0 {
+			return "must be even"
+		}
+		return ""
+	})
+	t.Cleanup(func() {
+		rulesMu.Lock()
+		delete(rules, "even")
+		rulesMu.Unlock()
+	})
+
+	var input struct {
+		Count int `json:"count" validate:"even"`
+	}
+
+	input.Count = 3
+	v := New()
+	v.Struct(input)
+
+	want := map[string]string{"count": "count must be even"}
+	if !maps.Equal(v.Errors, want) {
+		t.Errorf("got errors %v, want %v", v.Errors, want)
+	}
+
+	input.Count = 4
+	v = New()
+	v.Struct(input)
+
+	if !v.Valid() {
+		t.Errorf("got errors %v, want none", v.Errors)
+	}
+
+	for _, name := range []string{"even", "max", "required"} {
+		t.Run("duplicate "+name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterRule(%q) did not panic", name)
+				}
+			}()
+
+			RegisterRule(name, func(reflect.Value, string) string { return "" })
+		})
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Struct did not panic on an unknown rule")
+		}
+	}()
+
+	var input struct {
+		Name string `json:"name" validate:"shouty"`
+	}
+	input.Name = "Acme"
+
+	New().Struct(input)
+}
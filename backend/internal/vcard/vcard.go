@@ -0,0 +1,292 @@
+// Package vcard reads and writes the subset of vCard (RFC 6350) that
+// contacts use: name, email, title and organization.
+package vcard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MediaType is the vCard media type.
+const MediaType = "text/vcard"
+
+// Card is a single vCard.
+type Card struct {
+	UID   string
+	Name  string
+	Email string
+	Title string
+	Org   string
+	Rev   time.Time
+}
+
+// maxLineOctets is where lines are folded, per RFC 6350 section 3.2.
+const maxLineOctets = 75
+
+// Encode writes card as vCard 4.0. Empty properties are left out.
+func Encode(w io.Writer, card Card) error {
+	bw := bufio.NewWriter(w)
+
+	write := func(name, value string) {
+		if value == "" {
+			return
+		}
+		bw.WriteString(fold(name + ":" + value))
+		bw.WriteString("\r\n")
+	}
+
+	write("BEGIN", "VCARD")
+	write("VERSION", "4.0")
+	write("UID", card.UID)
+	write("FN", escape(card.Name))
+	write("EMAIL", escape(card.Email))
+	write("TITLE", escape(card.Title))
+	write("ORG", escape(card.Org))
+	if !card.Rev.IsZero() {
+		write("REV", card.Rev.UTC().Format("20060102T150405Z"))
+	}
+	write("END", "VCARD")
+
+	return bw.Flush()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold splits line into lines of at most maxLineOctets octets, continued
+// with a leading space and never splitting a UTF-8 sequence.
+func fold(line string) string {
+	var b strings.Builder
+
+	limit := maxLineOctets
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+
+		b.WriteString(line[:i])
+		b.WriteString("\r\n ")
+		line = line[i:]
+
+		// Continuation lines start with the space.
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+
+	return b.String()
+}
+
+// Decode reads every card in r. It accepts vCard 2.1, 3.0 and 4.0 as
+// written by phones and mail clients; properties other than those in Card
+// are ignored. When a card has several emails the preferred one is used.
+func Decode(r io.Reader) ([]Card, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	var card *Card
+	emailPref := 0
+
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, params, value, ok := parseLine(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d is not a vCard property", n+1)
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			if card != nil {
+				return nil, fmt.Errorf("line %d begins a card inside another", n+1)
+			}
+			card = &Card{}
+			emailPref = 0
+			continue
+		case card == nil:
+			return nil, fmt.Errorf("line %d is outside of a card", n+1)
+		case name == "END" && strings.EqualFold(value, "VCARD"):
+			cards = append(cards, *card)
+			card = nil
+			continue
+		}
+
+		switch name {
+		case "UID":
+			card.UID = value
+		case "FN":
+			card.Name = unescape(value)
+		case "N":
+			// FN is required by vCard 3.0 and 4.0 but some older cards
+			// only have N: family;given;additional;prefix;suffix.
+			if card.Name == "" {
+				parts := splitComponents(value)
+				for len(parts) < 2 {
+					parts = append(parts, "")
+				}
+				card.Name = strings.TrimSpace(parts[1] + " " + parts[0])
+			}
+		case "EMAIL":
+			pref := preference(params)
+			if card.Email == "" || pref > emailPref {
+				card.Email = unescape(value)
+				emailPref = pref
+			}
+		case "TITLE":
+			card.Title = unescape(value)
+		case "ORG":
+			// ORG is the organization name followed by units.
+			card.Org = splitComponents(value)[0]
+		}
+	}
+
+	if card != nil {
+		return nil, errors.New("last card has no END:VCARD")
+	}
+
+	return cards, nil
+}
+
+// unfold reads r as lines, joining folded lines back together.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+
+		if len(lines) > 0 {
+			prev := &lines[len(lines)-1]
+
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				*prev += line[1:]
+				continue
+			}
+
+			// Quoted-printable values end lines with "=" to continue them.
+			if strings.HasSuffix(*prev, "=") && quotedPrintable(*prev) {
+				*prev = strings.TrimSuffix(*prev, "=") + line
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+func quotedPrintable(line string) bool {
+	head, _, _ := strings.Cut(line, ":")
+	return strings.Contains(strings.ToUpper(head), "QUOTED-PRINTABLE")
+}
+
+// parseLine splits a content line such as "item1.EMAIL;TYPE=work:a@b.co"
+// into its upper-cased name without group, parameters and value. Values
+// quoted-printable encoded by vCard 2.1 are decoded.
+func parseLine(line string) (string, []string, string, bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, "", false
+	}
+
+	if quotedPrintable(line) {
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+		if err != nil {
+			return "", nil, "", false
+		}
+		value = string(decoded)
+	}
+
+	params := strings.Split(head, ";")
+	name := strings.ToUpper(params[0])
+	if _, after, grouped := strings.Cut(name, "."); grouped {
+		name = after
+	}
+
+	return name, params[1:], value, true
+}
+
+// preference ranks a property by its parameters: PREF=1 (4.0) or
+// TYPE=pref (3.0) outranks none. Higher is preferred.
+func preference(params []string) int {
+	for _, param := range params {
+		key, value, _ := strings.Cut(strings.ToUpper(param), "=")
+		switch {
+		case key == "PREF" && value == "":
+			// vCard 2.1 flags the preferred property with a bare PREF.
+			return 100
+		case key == "PREF":
+			n, err := strconv.Atoi(value)
+			if err == nil && n > 0 {
+				return 101 - min(n, 100)
+			}
+		case key == "TYPE" && slices.Contains(strings.Split(value, ","), "PREF"):
+			return 100
+		}
+	}
+
+	return 0
+}
+
+// splitComponents splits a structured value at unescaped semicolons and
+// unescapes each component.
+func splitComponents(value string) []string {
+	var parts []string
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			b.WriteByte(value[i])
+			b.WriteByte(value[i+1])
+			i++
+		case value[i] == ';':
+			parts = append(parts, unescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+
+	return append(parts, unescape(b.String()))
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,198 @@
+package vcard
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		card Card
+	}{
+		{"plain", Card{UID: "urn:uuid:1", Name: "Jane Doe", Email: "jane@acme.test", Title: "CTO", Org: "Acme"}},
+		{"escaped", Card{Name: `Doe; Jane, Jr. \ II`, Title: "Head of R&D, APAC; interim", Org: `Acme\Labs`}},
+		{"newline", Card{Name: "Jane", Title: "Line one\nLine two"}},
+		{"long utf-8", Card{Name: strings.Repeat("é", 80), Org: strings.Repeat("日本", 40)}},
+		{"emoji across the fold", Card{Name: strings.Repeat("a", 70) + strings.Repeat("😀", 10)}},
+		{"name only", Card{Name: "Jane"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.card); err != nil {
+				t.Fatal(err)
+			}
+
+			cards, err := Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(cards) != 1 || !reflect.DeepEqual(cards[0], tt.card) {
+				t.Errorf("got %+v, want [%+v]", cards, tt.card)
+			}
+		})
+	}
+}
+
+func TestEncodeFolds(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, Card{
+		Name: strings.Repeat("é", 80),
+		Org:  strings.Repeat("x", 74) + "日本語",
+		Rev:  time.Date(2026, time.October, 18, 9, 30, 0, 0, time.FixedZone("PHT", 8*60*60)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Error("output doesn't end in CRLF")
+	}
+	if !strings.Contains(out, "\r\nREV:20261018T013000Z\r\n") {
+		t.Errorf("REV missing or not in UTC:\n%s", out)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line is %d octets, longer than %d: %q", len(line), maxLineOctets, line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a UTF-8 sequence: %q", line)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Card
+	}{
+		{
+			name: "vcard 2.1 quoted-printable",
+			input: "BEGIN:VCARD\r\n" +
+				"VERSION:2.1\r\n" +
+				"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Dupont;Ren=C3=A9\r\n" +
+				"FN;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Ren=C3=A9 =\r\n" +
+				"Dupont\r\n" +
+				"TITLE;ENCODING=QUOTED-PRINTABLE:Directeur =3D g=C3=A9n=C3=A9ral\r\n" +
+				"EMAIL;INTERNET:rene@exemple.test\r\n" +
+				"END:VCARD\r\n",
+			want: []Card{{Name: "René Dupont", Title: "Directeur = général", Email: "rene@exemple.test"}},
+		},
+		{
+			name:  "n only",
+			input: "BEGIN:VCARD\nVERSION:3.0\nN:Doe;Jane;;Dr.;\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane Doe"}},
+		},
+		{
+			name:  "n with family name only",
+			input: "BEGIN:VCARD\nN:Doe\nEND:VCARD\n",
+			want:  []Card{{Name: "Doe"}},
+		},
+		{
+			name:  "n with escaped semicolon",
+			input: "BEGIN:VCARD\nN:O\\;Brien;Pat\nEND:VCARD\n",
+			want:  []Card{{Name: "Pat O;Brien"}},
+		},
+		{
+			name:  "fn wins over n",
+			input: "BEGIN:VCARD\nN:Doe;Jane\nFN:Jane Q. Doe\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane Q. Doe"}},
+		},
+		{
+			name: "pref ranking 4.0",
+			input: "BEGIN:VCARD\nVERSION:4.0\nFN:Jane\n" +
+				"EMAIL:none@acme.test\n" +
+				"EMAIL;PREF=3:three@acme.test\n" +
+				"EMAIL;PREF=1:one@acme.test\n" +
+				"EMAIL;PREF=2:two@acme.test\n" +
+				"END:VCARD\n",
+			want: []Card{{Name: "Jane", Email: "one@acme.test"}},
+		},
+		{
+			name: "pref ranking 3.0",
+			input: "BEGIN:VCARD\nVERSION:3.0\nFN:Jane\n" +
+				"EMAIL;TYPE=INTERNET:home@acme.test\n" +
+				"EMAIL;TYPE=INTERNET,pref:work@acme.test\n" +
+				"END:VCARD\n",
+			want: []Card{{Name: "Jane", Email: "work@acme.test"}},
+		},
+		{
+			name: "pref ranking 2.1",
+			input: "BEGIN:VCARD\nVERSION:2.1\nFN:Jane\n" +
+				"EMAIL;INTERNET:home@acme.test\n" +
+				"EMAIL;INTERNET;PREF:work@acme.test\n" +
+				"END:VCARD\n",
+			want: []Card{{Name: "Jane", Email: "work@acme.test"}},
+		},
+		{
+			name:  "first email without preferences",
+			input: "BEGIN:VCARD\nFN:Jane\nEMAIL:a@acme.test\nEMAIL:b@acme.test\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane", Email: "a@acme.test"}},
+		},
+		{
+			name:  "grouped property",
+			input: "BEGIN:VCARD\nFN:Jane\nitem1.EMAIL;type=INTERNET:jane@acme.test\nitem1.X-ABLabel:work\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane", Email: "jane@acme.test"}},
+		},
+		{
+			name:  "escaped text",
+			input: "BEGIN:VCARD\nFN:Doe\\, Jane\nTITLE:Sales\\; APAC\\nInterim\nORG:Acme\\; Inc.;Sales;APAC\nEND:VCARD\n",
+			want:  []Card{{Name: "Doe, Jane", Title: "Sales; APAC\nInterim", Org: "Acme; Inc."}},
+		},
+		{
+			name:  "folded with tab",
+			input: "BEGIN:VCARD\nFN:Ja\n\tne\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane"}},
+		},
+		{
+			name:  "byte order mark and blank lines",
+			input: "\uFEFFBEGIN:VCARD\n\nFN:Jane\nEND:VCARD\n\nBEGIN:VCARD\nFN:John\nEND:VCARD\n",
+			want:  []Card{{Name: "Jane"}, {Name: "John"}},
+		},
+		{
+			name:  "lower-case names",
+			input: "begin:vcard\nfn:Jane\nemail:jane@acme.test\nend:vcard\n",
+			want:  []Card{{Name: "Jane", Email: "jane@acme.test"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cards, err := Decode(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cards, tt.want) {
+				t.Errorf("got %+v, want %+v", cards, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := map[string]string{
+		"not a property": "BEGIN:VCARD\nFN Jane\nEND:VCARD\n",
+		"nested card":    "BEGIN:VCARD\nBEGIN:VCARD\nEND:VCARD\n",
+		"outside a card": "FN:Jane\n",
+		"no end":         "BEGIN:VCARD\nFN:Jane\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(strings.NewReader(input)); err == nil {
+				t.Errorf("Decode(%q) succeeded, want an error", input)
+			}
+		})
+	}
+}
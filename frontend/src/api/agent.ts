@@ -2,7 +2,7 @@ import axios, { AxiosError, type AxiosResponse } from 'axios';
 
 import type { Company } from '@/features/company/types/company';
 
-const BASE_URL = 'http://localhost:4000';
+const BASE_URL = 'http://localhost:4000/v1';
 
 const responseBody = <T>(res: AxiosResponse<T>) => res.data;
 
@@ -39,7 +39,11 @@ const companies = {
   getCompanies: (page?: number, pageSize?: number, sort?: string) =>
     requests.get<DataResponse<Company[]>>(`${BASE_URL}/companies`),
   create: () => requests.post(`${BASE_URL}/companies`, {}),
-  update: () => requests.patch(`${BASE_URL}/companies`, {}),
+  update: (id: string, body: Partial<Company>) =>
+    requests.patch<Omit<DataResponse<Company>, 'metadata'>, Partial<Company>>(
+      `${BASE_URL}/companies/${id}`,
+      body
+    ),
   delete: (id: string) => requests.delete(`${BASE_URL}/companies/${id}`)
 };
 